@@ -1,22 +1,30 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"strconv"
+	"syscall"
 
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/auth"
 	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
 	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/server"
 	"go.uber.org/zap"
+
+	// Games linked into the binary, registering themselves on init
+	_ "github.com/JJ-Intelligence/SR-Games-Backend/plugins/games/tictactoe"
 )
 
 var (
-	port         = flag.String("port", os.Getenv("PORT"), "Port to host the server on")
-	maxWorkers   = flag.Int("maxWorkers", getEnvOrDefault("MAX_WORKERS", 10).(int), "Maximum number of workers handling socket requests")
-	frontendHost = flag.String("frontendHost", os.Getenv("FRONTEND_HOST"), "The frontend host")
-	configPath   = flag.String("configPath", os.Getenv("CONFIG_PATH"), "Path to the yaml config")
+	port          = flag.String("port", os.Getenv("PORT"), "Port to host the server on")
+	maxWorkers    = flag.Int("maxWorkers", getEnvOrDefault("MAX_WORKERS", 10).(int), "Maximum number of workers handling socket requests")
+	frontendHost  = flag.String("frontendHost", os.Getenv("FRONTEND_HOST"), "Comma separated origins allowed to use the server, e.g. https://example.com,https://*.example.com")
+	configPath    = flag.String("configPath", os.Getenv("CONFIG_PATH"), "Path to the yaml config")
+	sessionSecret = flag.String("sessionSecret", os.Getenv("SESSION_SECRET"), "Secret used to sign player session tokens")
+	trustProxy    = flag.Bool("trustProxy", getEnvBool("TRUST_PROXY"), "Take client IPs from X-Forwarded-For, overriding the config")
 )
 
 // getEnvOrDefault tries to get an Environment variable or returns a default
@@ -29,6 +37,12 @@ func getEnvOrDefault(key string, def interface{}) interface{} {
 	return def
 }
 
+// getEnvBool returns true if an Environment variable is set to true
+func getEnvBool(key string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(key))
+	return value
+}
+
 // checkFlagsSet will panic if a flag has not been set
 func checkFlagsSet() {
 	flag.VisitAll(func(f *flag.Flag) {
@@ -38,12 +52,6 @@ func checkFlagsSet() {
 	})
 }
 
-// checkOrigin checks a requests origin, returning true if the origin is valid.
-func checkOrigin(r *http.Request) bool {
-	origin := r.Header.Get("Origin")
-	return strings.Contains(origin, *frontendHost)
-}
-
 func main() {
 	flag.Parse()
 	checkFlagsSet()
@@ -52,9 +60,21 @@ func main() {
 
 	// Parse the config
 	config := config.ParseConfig(*configPath)
+	if *trustProxy {
+		config.RateLimits.TrustProxy = true
+	}
+	origins, err := server.ParseAllowedOrigins(*frontendHost)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid frontendHost: %s", err.Error()))
+	}
+
+	// Shut down gracefully on SIGTERM, which is sent on deploys
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
 	// Start-up the server
 	log.Info(fmt.Sprintf("Starting server on port %s", *port))
-	s := server.NewServer(log, checkOrigin, config)
-	s.Start(*port, *maxWorkers, *frontendHost)
+	tokens := auth.NewSigner([]byte(*sessionSecret), config.SessionTTL)
+	s := server.NewServer(log, origins, config, tokens)
+	s.Start(ctx, *port, *maxWorkers)
 }
@@ -3,9 +3,9 @@ module github.com/JJ-Intelligence/SR-Games-Backend
 go 1.16
 
 require (
-	github.com/google/uuid v1.3.0 // indirect
+	github.com/google/uuid v1.3.0
 	github.com/gorilla/websocket v1.4.2
-	github.com/mitchellh/mapstructure v1.4.1 // indirect
-	go.uber.org/zap v1.19.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/mitchellh/mapstructure v1.4.1
+	go.uber.org/zap v1.19.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,84 @@
+// Package auth signs and verifies player session tokens, which prove a client
+// was given its player ID by the server.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrExpiredToken = errors.New("session token has expired")
+)
+
+// Signer creates session tokens binding a player ID to an expiry time, signed
+// with HMAC-SHA256. It's safe to use from multiple goroutines.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewSigner creates a Signer whose tokens are valid for ttl.
+func NewSigner(secret []byte, ttl time.Duration) *Signer {
+	return &Signer{secret: secret, ttl: ttl}
+}
+
+// Sign creates a session token for the player, returning it along with when
+// it expires.
+func (s *Signer) Sign(playerID string) (string, time.Time) {
+	expires := time.Now().Add(s.ttl)
+	payload := playerID + "." + strconv.FormatInt(expires.Unix(), 10)
+	return encode([]byte(payload)) + "." + encode(s.mac(payload)), expires
+}
+
+// Verify checks a session token was signed with the secret and hasn't expired,
+// returning the player ID it was created for.
+func (s *Signer) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalidToken
+	}
+	payload, err := decode(parts[0])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	signature, err := decode(parts[1])
+	if err != nil || !hmac.Equal(signature, s.mac(string(payload))) {
+		return "", ErrInvalidToken
+	}
+
+	// Player IDs don't contain dots, so the expiry is after the last one
+	i := strings.LastIndex(string(payload), ".")
+	if i < 0 {
+		return "", ErrInvalidToken
+	}
+	playerID := string(payload[:i])
+	expires, err := strconv.ParseInt(string(payload[i+1:]), 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if time.Now().Unix() >= expires {
+		return "", ErrExpiredToken
+	}
+	return playerID, nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
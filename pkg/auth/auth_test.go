@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPlayerID = "0b8f6c64-55b9-4c4e-8a39-3f2a6b1c9d7e"
+
+func TestVerify(t *testing.T) {
+	signer := NewSigner([]byte("secret"), time.Hour)
+	token, _ := signer.Sign(testPlayerID)
+	other, _ := signer.Sign("6f1d2c3b-1a2b-4c5d-9e8f-7a6b5c4d3e2f")
+	forged, _ := NewSigner([]byte("wrong secret"), time.Hour).Sign(testPlayerID)
+	expired, _ := NewSigner([]byte("secret"), -time.Second).Sign(testPlayerID)
+	parts := strings.Split(token, ".")
+	otherParts := strings.Split(other, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", token, nil},
+		{"forged signature", forged, ErrInvalidToken},
+		{"another player's signature", parts[0] + "." + otherParts[1], ErrInvalidToken},
+		{"another player's payload", otherParts[0] + "." + parts[1], ErrInvalidToken},
+		{"tampered signature", parts[0] + "." + flipFirst(parts[1]), ErrInvalidToken},
+		{"tampered payload", flipFirst(parts[0]) + "." + parts[1], ErrInvalidToken},
+		{"expired", expired, ErrExpiredToken},
+		{"empty", "", ErrInvalidToken},
+		{"no signature", parts[0], ErrInvalidToken},
+		{"empty signature", parts[0] + ".", ErrInvalidToken},
+		{"truncated signature", token[:len(token)-4], ErrInvalidToken},
+		{"extra part", token + ".extra", ErrInvalidToken},
+		{"not base64", "not base64!." + parts[1], ErrInvalidToken},
+		{"unsigned player ID", testPlayerID, ErrInvalidToken},
+	}
+	for _, test := range tests {
+		playerID, err := signer.Verify(test.token)
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		} else if err == nil && playerID != testPlayerID {
+			t.Errorf("%s: got player ID %s, want %s", test.name, playerID, testPlayerID)
+		}
+	}
+}
+
+func TestVerifyMalformedPayload(t *testing.T) {
+	signer := NewSigner([]byte("secret"), time.Hour)
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"no expiry", testPlayerID},
+		{"invalid expiry", testPlayerID + ".soon"},
+	}
+	for _, test := range tests {
+		// Correctly signed, so only the payload's contents are wrong
+		token := encode([]byte(test.payload)) + "." + encode(signer.mac(test.payload))
+		if _, err := signer.Verify(token); err != ErrInvalidToken {
+			t.Errorf("%s: got error %v, want %v", test.name, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestSignExpiry(t *testing.T) {
+	before := time.Now()
+	_, expires := NewSigner([]byte("secret"), time.Hour).Sign(testPlayerID)
+	if expires.Before(before.Add(time.Hour)) || expires.After(time.Now().Add(time.Hour)) {
+		t.Errorf("Token expires at %s, want an hour from now", expires)
+	}
+}
+
+// flipFirst changes the first character of a base64 string, which unlike the
+// last character is never just padding bits
+func flipFirst(s string) string {
+	replacement := "A"
+	if s[0] == 'A' {
+		replacement = "B"
+	}
+	return replacement + s[1:]
+}
@@ -1,41 +1,182 @@
 package comms
 
 import (
+	"sync"
+	"time"
+
 	"github.com/gorilla/websocket"
 )
 
 // Request holds a Message and connection of a connected client.
 type Request struct {
-	ConnChannel chan Message
-	PlayerID    string
-	Message     Message
+	Conn     *ConnectionWrapper
+	PlayerID string
+	Message  Message
+}
+
+// Reply sends a message back to the client which made the request, without
+// waiting for room in its queue. Requests raised by the server itself have no
+// connection, so replies are dropped.
+func (r *Request) Reply(contents interface{}) {
+	if r.Conn != nil {
+		r.Conn.SendOrClose(ToMessage(contents))
+	}
 }
 
 func (r *Request) Error(message string, err error) {
-	r.ConnChannel <- ToMessage(ErrorResponse{
+	r.Reply(ErrorResponse{
 		Reason: message,
 		Error:  err,
 	})
 }
 
 // ConnectionWrapper wraps a client connection, handling communication.
+// Messages are queued onto WriteChannel with Send, and written to the Socket
+// by a single writer goroutine.
 type ConnectionWrapper struct {
 	Socket       *websocket.Conn
 	WriteChannel chan Message
 	PlayerID     string
+
+	limits ConnectionLimits
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// ConnectionLimits protect the server from misbehaving clients, and detect
+// dead ones. Each limit is disabled if it's 0.
+type ConnectionLimits struct {
+	// MaxMessageSize is the largest message the client can send, in bytes
+	MaxMessageSize int64
+	// PongTimeout is how long the client can go without sending a message or
+	// answering a ping before reads fail
+	PongTimeout time.Duration
+	// WriteTimeout is how long a write can take before it fails
+	WriteTimeout time.Duration
 }
 
+func NewConnectionWrapper(
+	socket *websocket.Conn,
+	channelBufferLen int,
+	limits ConnectionLimits,
+) *ConnectionWrapper {
+	c := &ConnectionWrapper{
+		Socket:       socket,
+		WriteChannel: make(chan Message, channelBufferLen),
+		limits:       limits,
+		closed:       make(chan struct{}),
+	}
+	socket.SetReadLimit(limits.MaxMessageSize)
+	c.extendReadDeadline()
+	socket.SetPongHandler(func(string) error {
+		c.extendReadDeadline()
+		return nil
+	})
+	return c
+}
+
+// extendReadDeadline gives the client another PongTimeout to send something
+func (c *ConnectionWrapper) extendReadDeadline() {
+	if c.limits.PongTimeout > 0 {
+		c.Socket.SetReadDeadline(time.Now().Add(c.limits.PongTimeout))
+	}
+}
+
+// writeDeadline returns when a write started now should fail, or the zero time
+// if writes have no deadline
+func (c *ConnectionWrapper) writeDeadline() time.Time {
+	if c.limits.WriteTimeout > 0 {
+		return time.Now().Add(c.limits.WriteTimeout)
+	}
+	return time.Time{}
+}
+
+// ReadMessage reads the next message from the client, which must only be called
+// from the connection's reader goroutine.
 func (c *ConnectionWrapper) ReadMessage() (Message, error) {
 	var message Message
 	err := c.Socket.ReadJSON(&message)
+	if err == nil {
+		c.extendReadDeadline()
+	}
 	return message, err
 }
 
+// WriteMessage writes a message straight to the socket, so must only be
+// called from the connection's writer goroutine.
 func (c *ConnectionWrapper) WriteMessage(message Message) error {
+	c.Socket.SetWriteDeadline(c.writeDeadline())
 	return c.Socket.WriteJSON(message)
 }
 
+// WritePing sends a ping control frame, which the client answers with a pong.
+// It must only be called from the connection's writer goroutine.
+func (c *ConnectionWrapper) WritePing() error {
+	return c.Socket.WriteControl(websocket.PingMessage, nil, c.writeDeadline())
+}
+
+// WriteClose sends a close control frame with the reason the connection is
+// closing. It must only be called from the connection's writer goroutine.
+func (c *ConnectionWrapper) WriteClose(reason string) error {
+	return c.Socket.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
+		c.writeDeadline(),
+	)
+}
+
+// Send queues a message to be written to the client, returning false if the
+// connection has closed.
+func (c *ConnectionWrapper) Send(message Message) bool {
+	countErrorResponse(message)
+	select {
+	case c.WriteChannel <- message:
+		return true
+	case <-c.closed:
+		return false
+	}
+}
+
+// SendOrClose queues a message to be written to the client without waiting,
+// closing the connection if its queue is full as the client isn't keeping up.
+// It returns false if the message was dropped.
+func (c *ConnectionWrapper) SendOrClose(message Message) bool {
+	countErrorResponse(message)
+	if c.TrySend(message) {
+		return true
+	}
+	c.Close()
+	return false
+}
+
+func countErrorResponse(message Message) {
+	if _, ok := message.Contents.(ErrorResponse); ok {
+		errorResponses.Inc()
+	}
+}
+
+// TrySend queues a message to be written to the client if there's room,
+// returning false if it was dropped.
+func (c *ConnectionWrapper) TrySend(message Message) bool {
+	select {
+	case c.WriteChannel <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// Closed returns a channel which is closed once the connection has closed.
+func (c *ConnectionWrapper) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// Close closes the connection. It's safe to call more than once, from any
+// goroutine.
 func (c *ConnectionWrapper) Close() {
-	c.WriteChannel <- Message{Type: "CloseConnectionRequest"}
-	c.Socket.Close()
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.Socket.Close()
+	})
 }
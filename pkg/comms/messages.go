@@ -12,6 +12,9 @@ type Message struct {
 
 // Convert message contents into a Message
 func ToMessage(contents interface{}) Message {
+	if message, ok := contents.(Message); ok {
+		return message
+	}
 	return Message{
 		Type:     reflect.TypeOf(contents).Name(),
 		Contents: contents,
@@ -26,5 +29,10 @@ type ErrorResponse struct {
 
 type ErrorDecodingMessageResponse struct{}
 
-// Empty ping sent to the client to keep the websocket alive
-type Ping struct{}
+// RateLimitedResponse is sent instead of handling a message which was sent too
+// quickly. Clients which are rate limited too often are disconnected, and
+// removed from their lobby.
+type RateLimitedResponse struct {
+	MessageType  string `json:"messageType"`
+	Disconnected bool   `json:"disconnected"`
+}
@@ -0,0 +1,6 @@
+package comms
+
+import "github.com/JJ-Intelligence/SR-Games-Backend/pkg/metrics"
+
+var errorResponses = metrics.NewCounter(
+	"srgames_error_responses_total", "Number of error responses sent to clients.")
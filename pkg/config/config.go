@@ -4,17 +4,175 @@ import (
 	"fmt"
 	"io/ioutil"
 	"plugin"
+	"strings"
+	"time"
 
 	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
 	"gopkg.in/yaml.v2"
 )
 
+// RawYamlConfig is the config as written in yaml. Each entry under games maps
+// the name lobbies use for a game to a GameConfig.
 type RawYamlConfig struct {
-	Games map[string]string `yaml:"games"`
+	Games map[string]GameConfig `yaml:"games"`
+
+	// ReconnectGracePeriod is how long a disconnected player keeps their place
+	// in a lobby, defaulting to DEFAULT_RECONNECT_GRACE_PERIOD. Set it to 0 to
+	// remove players as soon as they disconnect.
+	ReconnectGracePeriod *time.Duration `yaml:"reconnectGracePeriod"`
+
+	// ShutdownTimeout is how long running games are given to finish when the
+	// server shuts down, defaulting to DEFAULT_SHUTDOWN_TIMEOUT
+	ShutdownTimeout *time.Duration `yaml:"shutdownTimeout"`
+
+	// SessionTTL is how long the session tokens given to new players are
+	// valid for, defaulting to DEFAULT_SESSION_TTL
+	SessionTTL *time.Duration `yaml:"sessionTTL"`
+
+	RateLimits RawRateLimitConfig `yaml:"rateLimits"`
+
+	Connection RawConnectionConfig `yaml:"connection"`
+}
+
+// RawConnectionConfig limits clients' websocket connections. Each limit has a
+// DEFAULT_ value, and is disabled if it's set to 0.
+type RawConnectionConfig struct {
+	// MaxMessageSize is the largest message a client can send, in bytes
+	MaxMessageSize *int64 `yaml:"maxMessageSize"`
+	// PingInterval is how often clients are pinged, to keep the connection
+	// alive and check the client is still there
+	PingInterval *time.Duration `yaml:"pingInterval"`
+	// PongTimeout is how long a client can go without sending a message or
+	// answering a ping before it's disconnected
+	PongTimeout *time.Duration `yaml:"pongTimeout"`
+	// WriteTimeout is how long writing to a client can take before it's
+	// disconnected
+	WriteTimeout *time.Duration `yaml:"writeTimeout"`
+}
+
+// RawRateLimitConfig limits how quickly clients can send messages and create
+// players and lobbies:
+//
+//	rateLimits:
+//	  messages:
+//	    default: {rate: 10, burst: 20}
+//	    LobbyChatMessageRequest: {rate: 1, burst: 5}
+//	    Game/*: {rate: 5, burst: 10}
+//	  maxViolationsPerMinute: 30
+//	  http: {rate: 0.2, burst: 10}
+//	  trustProxy: false
+type RawRateLimitConfig struct {
+	// Messages limits each connection's messages by type. Types without a
+	// limit share the default limit, which is DEFAULT_MESSAGE_RATE_LIMIT
+	// unless it's set, and "Game/*" sets the limit for all game messages.
+	Messages map[string]RateLimit `yaml:"messages"`
+
+	// MaxViolationsPerMinute is how many rate limited messages a connection
+	// can send in a minute before it's disconnected, defaulting to
+	// DEFAULT_MAX_RATE_LIMIT_VIOLATIONS
+	MaxViolationsPerMinute *int `yaml:"maxViolationsPerMinute"`
+
+	// HTTP limits each IP address's requests to /createPlayer, /createLobby
+	// and to open websocket connections, with a separate limit for each. It
+	// defaults to DEFAULT_HTTP_RATE_LIMIT.
+	HTTP *RateLimit `yaml:"http"`
+
+	// TrustProxy takes the client's IP address from the last
+	// X-Forwarded-For entry. It should only be set when running behind a proxy
+	// which sets the header, as clients can send it themselves otherwise.
+	TrustProxy bool `yaml:"trustProxy"`
+}
+
+// RateLimit is a token bucket, allowing rate requests a second on average in
+// bursts of up to burst requests
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// GameConfig says where to load a game from. It's either written as a string,
+// which is the name the game was registered with (see game.Register) or the
+// path of a .so plugin, or as a mapping with the command to run the game
+// out-of-process (see game.ProcessGame):
+//
+//	games:
+//	  tictactoe: tictactoe
+//	  chess:
+//	    command: [python3, ./games/chess.py]
+//	    timeout: 5s
+type GameConfig struct {
+	Source  string
+	Command []string
+	Timeout time.Duration
+}
+
+func (c *GameConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.Source); err == nil {
+		return nil
+	}
+
+	var process struct {
+		Command []string      `yaml:"command"`
+		Timeout time.Duration `yaml:"timeout"`
+	}
+	if err := unmarshal(&process); err != nil {
+		return err
+	}
+	c.Command = process.Command
+	c.Timeout = process.Timeout
+	return nil
 }
 
+const (
+	DEFAULT_RECONNECT_GRACE_PERIOD = 30 * time.Second
+	// DEFAULT_SHUTDOWN_TIMEOUT leaves time for sockets to close within the 30
+	// seconds Heroku and Kubernetes give the server to stop
+	DEFAULT_SHUTDOWN_TIMEOUT = 20 * time.Second
+	DEFAULT_SESSION_TTL      = 24 * time.Hour
+
+	DEFAULT_MAX_MESSAGE_SIZE = 64 * 1024
+	// DEFAULT_PING_INTERVAL is less than the 55s Heroku waits before closing
+	// idle connections
+	DEFAULT_PING_INTERVAL = 50 * time.Second
+	DEFAULT_PONG_TIMEOUT  = 60 * time.Second
+	DEFAULT_WRITE_TIMEOUT = 10 * time.Second
+
+	DEFAULT_MAX_RATE_LIMIT_VIOLATIONS = 30
+	// DEFAULT_RATE_LIMIT is the key of the message rate limit used for message
+	// types without their own limit
+	DEFAULT_RATE_LIMIT = "default"
+	// GAME_RATE_LIMIT is the key of the message rate limit used for game
+	// messages without their own limit
+	GAME_RATE_LIMIT = "Game/*"
+)
+
+var (
+	DEFAULT_MESSAGE_RATE_LIMIT = RateLimit{Rate: 10, Burst: 20}
+	DEFAULT_HTTP_RATE_LIMIT    = RateLimit{Rate: 0.2, Burst: 10}
+)
+
 type Config struct {
-	Games map[string]game.GameService
+	Games                map[string]game.Game
+	ReconnectGracePeriod time.Duration
+	ShutdownTimeout      time.Duration
+	SessionTTL           time.Duration
+	RateLimits           RateLimitConfig
+	Connection           ConnectionConfig
+}
+
+type ConnectionConfig struct {
+	MaxMessageSize int64
+	PingInterval   time.Duration
+	PongTimeout    time.Duration
+	WriteTimeout   time.Duration
+}
+
+type RateLimitConfig struct {
+	// Messages always has a DEFAULT_RATE_LIMIT
+	Messages               map[string]RateLimit
+	MaxViolationsPerMinute int
+	HTTP                   RateLimit
+	TrustProxy             bool
 }
 
 func ParseConfig(path string) *Config {
@@ -29,14 +187,131 @@ func ParseConfig(path string) *Config {
 		panic("Unable to parse yaml config")
 	}
 
-	games := make(map[string]game.GameService)
-	for name, pluginPath := range rawConfig.Games {
-		p, err := plugin.Open(pluginPath)
+	games := make(map[string]game.Game)
+	for name, gameConfig := range rawConfig.Games {
+		g, err := loadGame(gameConfig)
 		if err != nil {
 			panic(fmt.Sprintf(
-				"Unable to load game plugin from '%s': %s", pluginPath, err.Error()))
+				"Unable to load game %s: %s", name, err.Error()))
+		}
+		games[name] = g
+	}
+
+	reconnectGracePeriod := DEFAULT_RECONNECT_GRACE_PERIOD
+	if rawConfig.ReconnectGracePeriod != nil {
+		reconnectGracePeriod = *rawConfig.ReconnectGracePeriod
+	}
+	shutdownTimeout := DEFAULT_SHUTDOWN_TIMEOUT
+	if rawConfig.ShutdownTimeout != nil {
+		shutdownTimeout = *rawConfig.ShutdownTimeout
+	}
+	sessionTTL := DEFAULT_SESSION_TTL
+	if rawConfig.SessionTTL != nil {
+		sessionTTL = *rawConfig.SessionTTL
+	}
+	rateLimits, err := parseRateLimits(rawConfig.RateLimits)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid rate limits: %s", err.Error()))
+	}
+	connection, err := parseConnectionConfig(rawConfig.Connection)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid connection config: %s", err.Error()))
+	}
+
+	return &Config{
+		Games:                games,
+		ReconnectGracePeriod: reconnectGracePeriod,
+		ShutdownTimeout:      shutdownTimeout,
+		SessionTTL:           sessionTTL,
+		RateLimits:           rateLimits,
+		Connection:           connection,
+	}
+}
+
+// parseConnectionConfig fills in the defaults for any connection limits left
+// out
+func parseConnectionConfig(raw RawConnectionConfig) (ConnectionConfig, error) {
+	connection := ConnectionConfig{
+		MaxMessageSize: DEFAULT_MAX_MESSAGE_SIZE,
+		PingInterval:   DEFAULT_PING_INTERVAL,
+		PongTimeout:    DEFAULT_PONG_TIMEOUT,
+		WriteTimeout:   DEFAULT_WRITE_TIMEOUT,
+	}
+	if raw.MaxMessageSize != nil {
+		connection.MaxMessageSize = *raw.MaxMessageSize
+	}
+	if raw.PingInterval != nil {
+		connection.PingInterval = *raw.PingInterval
+	}
+	if raw.PongTimeout != nil {
+		connection.PongTimeout = *raw.PongTimeout
+	}
+	if raw.WriteTimeout != nil {
+		connection.WriteTimeout = *raw.WriteTimeout
+	}
+
+	if connection.MaxMessageSize < 0 || connection.PingInterval < 0 ||
+		connection.PongTimeout < 0 || connection.WriteTimeout < 0 {
+		return connection, fmt.Errorf("connection limits can't be negative")
+	}
+	// Idle clients only send pongs, so would time out without pings
+	if connection.PongTimeout > 0 &&
+		(connection.PingInterval == 0 || connection.PingInterval >= connection.PongTimeout) {
+		return connection, fmt.Errorf("ping interval must be less than the pong timeout")
+	}
+	return connection, nil
+}
+
+// parseRateLimits fills in the defaults for any rate limits left out
+func parseRateLimits(raw RawRateLimitConfig) (RateLimitConfig, error) {
+	limits := RateLimitConfig{
+		Messages:               map[string]RateLimit{DEFAULT_RATE_LIMIT: DEFAULT_MESSAGE_RATE_LIMIT},
+		MaxViolationsPerMinute: DEFAULT_MAX_RATE_LIMIT_VIOLATIONS,
+		HTTP:                   DEFAULT_HTTP_RATE_LIMIT,
+		TrustProxy:             raw.TrustProxy,
+	}
+	for messageType, limit := range raw.Messages {
+		limits.Messages[messageType] = limit
+	}
+	if raw.MaxViolationsPerMinute != nil {
+		limits.MaxViolationsPerMinute = *raw.MaxViolationsPerMinute
+	}
+	if raw.HTTP != nil {
+		limits.HTTP = *raw.HTTP
+	}
+
+	for messageType, limit := range limits.Messages {
+		if limit.Rate <= 0 || limit.Burst < 1 {
+			return limits, fmt.Errorf("invalid rate limit for %s", messageType)
+		}
+	}
+	if limits.HTTP.Rate <= 0 || limits.HTTP.Burst < 1 {
+		return limits, fmt.Errorf("invalid http rate limit")
+	}
+	if limits.MaxViolationsPerMinute < 1 {
+		return limits, fmt.Errorf("max violations per minute must be at least 1")
+	}
+	return limits, nil
+}
+
+// loadGame loads a game to be run out-of-process if it has a command, from a
+// plugin if its source is a .so path, otherwise looking it up in the games
+// registered at compile-time.
+func loadGame(c GameConfig) (game.Game, error) {
+	if len(c.Command) > 0 {
+		return game.ProcessGame{Command: c.Command, Timeout: c.Timeout}, nil
+	}
+
+	if strings.HasSuffix(c.Source, ".so") {
+		p, err := plugin.Open(c.Source)
+		if err != nil {
+			return nil, err
 		}
-		games[name] = game.NewGame(name, p)
+		return game.NewGame(c.Source, p)
+	}
+
+	if g, ok := game.Lookup(c.Source); ok {
+		return g, nil
 	}
-	return &Config{Games: games}
+	return nil, fmt.Errorf("no game registered as '%s'", c.Source)
 }
@@ -0,0 +1,99 @@
+package game
+
+import (
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+)
+
+// TimerID identifies a timer scheduled by a game
+type TimerID int
+
+// Lobby is implemented by the lobby running a game, giving the game's Context
+// access to it.
+type Lobby interface {
+	// ID returns the lobby's ID
+	ID() string
+	// Players returns the IDs of the players in the game
+	Players() []string
+	// SendGameMessage sends a game message to the given players, and to the
+	// lobby's spectators too if it's public
+	SendGameMessage(message comms.Message, players []string, public bool)
+	// EndGame ends the game, telling players the result
+	EndGame(result Result)
+	// AbortGame ends the game early, telling players the reason
+	AbortGame(reason string)
+	// ScheduleTimer calls fn on the lobby's goroutine after d, or every d if
+	// repeat is set, until the timer is cancelled or the game ends
+	ScheduleTimer(d time.Duration, repeat bool, fn func()) TimerID
+	// CancelTimer stops a scheduled timer
+	CancelTimer(id TimerID)
+}
+
+// Context is passed to every call into a game, and is how the game talks to
+// the lobby and its players.
+type Context struct {
+	lobby Lobby
+}
+
+func NewContext(lobby Lobby) *Context {
+	return &Context{lobby: lobby}
+}
+
+// LobbyID returns the ID of the lobby running the game.
+func (c *Context) LobbyID() string {
+	return c.lobby.ID()
+}
+
+// Players returns the IDs of the players in the game.
+func (c *Context) Players() []string {
+	return c.lobby.Players()
+}
+
+// Send sends a message to the given players. Clients receive it with the type
+// "Game/<contents type name>".
+func (c *Context) Send(contents interface{}, players ...string) {
+	c.lobby.SendGameMessage(comms.ToMessage(contents), players, false)
+}
+
+// Broadcast sends a message to every player in the game.
+func (c *Context) Broadcast(contents interface{}) {
+	c.Send(contents, c.Players()...)
+}
+
+// BroadcastPublic sends a message to every player in the game and to anyone
+// spectating it, so shouldn't reveal anything players need to keep hidden.
+func (c *Context) BroadcastPublic(contents interface{}) {
+	c.lobby.SendGameMessage(comms.ToMessage(contents), c.Players(), true)
+}
+
+// End ends the game once the current call into it returns, reporting the
+// result to the lobby, which tells players and returns them to the lobby. The
+// game's State gets no further calls other than OnEnd.
+func (c *Context) End(result Result) {
+	c.lobby.EndGame(result)
+}
+
+// Abort ends the game early, telling players the reason. The game's State
+// gets no further calls once the current one returns, other than OnEnd.
+func (c *Context) Abort(reason string) {
+	c.lobby.AbortGame(reason)
+}
+
+// AfterFunc calls fn after d, unless the timer is cancelled or the game ends
+// first. Like every other call into the game, fn is called on the lobby's
+// goroutine, so it can safely use the game's state.
+func (c *Context) AfterFunc(d time.Duration, fn func(ctx *Context)) TimerID {
+	return c.lobby.ScheduleTimer(d, false, func() { fn(c) })
+}
+
+// Every calls fn every d, until the timer is cancelled or the game ends.
+func (c *Context) Every(d time.Duration, fn func(ctx *Context)) TimerID {
+	return c.lobby.ScheduleTimer(d, true, func() { fn(c) })
+}
+
+// CancelTimer stops a timer scheduled by AfterFunc or Every. Cancelling a
+// timer which has already fired does nothing.
+func (c *Context) CancelTimer(id TimerID) {
+	c.lobby.CancelTimer(id)
+}
@@ -3,32 +3,125 @@ package game
 import (
 	"fmt"
 	"plugin"
+	"time"
 
 	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
 )
 
+// GameRequest is a message a game sends to some of its players. Public
+// messages are sent to spectators too.
 type GameRequest struct {
 	Players []string
 	Message comms.Message
+	Public  bool
 }
 
-type GameService struct {
-	NewState      func([]string) (interface{}, error)
-	HandleRequest func(chan GameRequest, interface{}, string, string, interface{}) interface{}
+// Result is the outcome of a game, reported through Context.End
+type Result struct {
+	Winners []string       `json:"winners"`
+	Losers  []string       `json:"losers"`
+	Draw    bool           `json:"draw"`
+	Scores  map[string]int `json:"scores,omitempty"`
 }
 
-func NewGame(name string, p *plugin.Plugin) GameService {
-	newState, err := p.Lookup("NewState")
+// Game is implemented by each game the server can run.
+type Game interface {
+	// NewState creates the state of a new game between ctx.Players(),
+	// returning an error if the game can't be started.
+	NewState(ctx *Context) (State, error)
+}
+
+// State holds a single running game, created by Game.NewState.
+type State interface {
+	// HandleRequest handles a "Game/<messageType>" message sent by a player,
+	// returning a message to send back to that player, or nil.
+	HandleRequest(ctx *Context, playerID, messageType string, contents interface{}) interface{}
+}
+
+// Starter is optionally implemented by a State which needs to act once all
+// players have been told the game has started.
+type Starter interface {
+	OnStart(ctx *Context)
+}
+
+// Ender is optionally implemented by a State which needs to clean up when its
+// game is torn down.
+type Ender interface {
+	OnEnd(ctx *Context)
+}
+
+// Ticker is optionally implemented by a State which runs at a fixed tick rate,
+// e.g. a real-time game. OnTick is called every TickRate from when the game
+// starts until it ends.
+type Ticker interface {
+	TickRate() time.Duration
+	OnTick(ctx *Context)
+}
+
+// PlayerLeftHandler is optionally implemented by a State which needs to know
+// when one of its players leaves the lobby mid-game, e.g. to forfeit, pause,
+// or substitute a bot.
+type PlayerLeftHandler interface {
+	OnPlayerLeft(ctx *Context, playerID string)
+}
+
+// PlayerRejoinedHandler is optionally implemented by a State which needs to
+// know when a player who left mid-game rejoins the lobby.
+type PlayerRejoinedHandler interface {
+	OnPlayerRejoined(ctx *Context, playerID string)
+}
+
+// PlayerLimits is optionally implemented by a Game which needs a certain number
+// of players, so lobbies can check before starting it.
+type PlayerLimits interface {
+	// MinPlayers and MaxPlayers return 0 if there's no limit
+	MinPlayers() int
+	MaxPlayers() int
+}
+
+// Teamed is optionally implemented by a State which splits its players into
+// teams, letting players send lobby chat to just their team.
+type Teamed interface {
+	// Team returns the player's team, or an empty string if they're not in one
+	Team(playerID string) string
+}
+
+// NewGame loads a Game from a plugin. Plugins either export a Game variable
+// implementing Game, or the NewState and HandleRequest functions of the
+// original plugin API (see LegacyGame).
+func NewGame(name string, p *plugin.Plugin) (Game, error) {
+	if gameSymbol, err := p.Lookup("Game"); err == nil {
+		g, ok := gameSymbol.(*Game)
+		if !ok || *g == nil {
+			return nil, fmt.Errorf("Game does not implement game.Game for plugin %s", name)
+		}
+		return *g, nil
+	}
+
+	newStateSymbol, err := p.Lookup("NewState")
 	if err != nil {
-		panic(fmt.Sprintf("NewState function does not exist for plugin %s", name))
+		return nil, fmt.Errorf(
+			"NewState function does not exist for plugin %s", name)
 	}
-	handleRequest, err := p.Lookup("HandleRequest")
+	handleRequestSymbol, err := p.Lookup("HandleRequest")
 	if err != nil {
-		panic(fmt.Sprintf("HandleRequest function does not exist for plugin %s", name))
+		return nil, fmt.Errorf(
+			"HandleRequest function does not exist for plugin %s", name)
 	}
 
-	return GameService{
-		NewState:      newState.(func([]string) (interface{}, error)),
-		HandleRequest: handleRequest.(func(chan GameRequest, interface{}, string, string, interface{}) interface{}),
+	newState, ok := newStateSymbol.(func([]string) (interface{}, error))
+	if !ok {
+		return nil, fmt.Errorf(
+			"NewState function has the wrong signature for plugin %s", name)
 	}
+	handleRequest, ok := handleRequestSymbol.(func(chan GameRequest, interface{}, string, string, interface{}) interface{})
+	if !ok {
+		return nil, fmt.Errorf(
+			"HandleRequest function has the wrong signature for plugin %s", name)
+	}
+
+	return LegacyGame{
+		NewStateFunc:      newState,
+		HandleRequestFunc: handleRequest,
+	}, nil
 }
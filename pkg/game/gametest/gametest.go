@@ -0,0 +1,100 @@
+// Package gametest runs games without a lobby, so they can be unit tested
+// without building plugins or connecting players.
+package gametest
+
+import (
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+)
+
+// Lobby stands in for the lobby running a game, recording everything the game
+// does through its Context.
+type Lobby struct {
+	LobbyID   string
+	PlayerIDs []string
+
+	// Sent holds the messages the game has sent, in order
+	Sent []Message
+	// Result is set once the game ends
+	Result *game.Result
+	// AbortReason is set once the game aborts
+	AbortReason string
+
+	ctx         *game.Context
+	timers      map[game.TimerID]timer
+	nextTimerID game.TimerID
+}
+
+// Message is a message sent by a game
+type Message struct {
+	comms.Message
+	Players []string
+	Public  bool
+}
+
+type timer struct {
+	fn     func()
+	repeat bool
+}
+
+// NewLobby creates a Lobby running a game between the given players.
+func NewLobby(players ...string) *Lobby {
+	l := &Lobby{
+		LobbyID:   "test",
+		PlayerIDs: players,
+		timers:    make(map[game.TimerID]timer),
+	}
+	l.ctx = game.NewContext(l)
+	return l
+}
+
+// Context returns the Context to pass to the game.
+func (l *Lobby) Context() *game.Context {
+	return l.ctx
+}
+
+// FireTimer calls the function of a timer the game scheduled, as if it had
+// fired, returning false if there's no such timer.
+func (l *Lobby) FireTimer(id game.TimerID) bool {
+	t, ok := l.timers[id]
+	if !ok {
+		return false
+	}
+	if !t.repeat {
+		delete(l.timers, id)
+	}
+	t.fn()
+	return true
+}
+
+func (l *Lobby) ID() string {
+	return l.LobbyID
+}
+
+func (l *Lobby) Players() []string {
+	return l.PlayerIDs
+}
+
+func (l *Lobby) SendGameMessage(message comms.Message, players []string, public bool) {
+	l.Sent = append(l.Sent, Message{Message: message, Players: players, Public: public})
+}
+
+func (l *Lobby) EndGame(result game.Result) {
+	l.Result = &result
+}
+
+func (l *Lobby) AbortGame(reason string) {
+	l.AbortReason = reason
+}
+
+func (l *Lobby) ScheduleTimer(d time.Duration, repeat bool, fn func()) game.TimerID {
+	l.nextTimerID++
+	l.timers[l.nextTimerID] = timer{fn: fn, repeat: repeat}
+	return l.nextTimerID
+}
+
+func (l *Lobby) CancelTimer(id game.TimerID) {
+	delete(l.timers, id)
+}
@@ -0,0 +1,55 @@
+package game
+
+// LegacyGame adapts a game written against the original plugin API, of
+// NewState and HandleRequest functions, to the Game interface.
+type LegacyGame struct {
+	NewStateFunc      func([]string) (interface{}, error)
+	HandleRequestFunc func(chan GameRequest, interface{}, string, string, interface{}) interface{}
+}
+
+func (g LegacyGame) NewState(ctx *Context) (State, error) {
+	state, err := g.NewStateFunc(ctx.Players())
+	if err != nil {
+		return nil, err
+	}
+	return &legacyState{game: g, state: state}, nil
+}
+
+type legacyState struct {
+	game  LegacyGame
+	state interface{}
+}
+
+// HandleRequest runs the legacy HandleRequest function in its own goroutine,
+// forwarding whatever it sends on its channel to the Context, so that the
+// Context is only ever used from the caller's goroutine.
+func (s *legacyState) HandleRequest(
+	ctx *Context,
+	playerID,
+	messageType string,
+	contents interface{},
+) interface{} {
+	var (
+		gameChan  = make(chan GameRequest)
+		response  interface{}
+		recovered interface{}
+	)
+	go func() {
+		defer func() {
+			recovered = recover()
+			close(gameChan)
+		}()
+		response = s.game.HandleRequestFunc(
+			gameChan, s.state, playerID, messageType, contents)
+	}()
+
+	for req := range gameChan {
+		ctx.lobby.SendGameMessage(req.Message, req.Players, req.Public)
+	}
+
+	// Re-raise any panic on the caller's goroutine
+	if recovered != nil {
+		panic(recovered)
+	}
+	return response
+}
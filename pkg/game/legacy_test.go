@@ -0,0 +1,120 @@
+package game_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game/gametest"
+)
+
+// legacyCounter is the state of a game written against the original plugin
+// API, which counts the requests it's sent
+type legacyCounter struct {
+	players []string
+	count   int
+}
+
+type countBroadcast struct {
+	Count int
+}
+
+func newLegacyCounter(players []string) (interface{}, error) {
+	if len(players) == 0 {
+		return nil, errors.New("no players")
+	}
+	return &legacyCounter{players: players}, nil
+}
+
+func handleLegacyCounter(
+	gameChan chan game.GameRequest,
+	state interface{},
+	playerID, messageType string,
+	contents interface{},
+) interface{} {
+	counter := state.(*legacyCounter)
+	switch messageType {
+	case "Count":
+		counter.count++
+		gameChan <- game.GameRequest{
+			Players: counter.players,
+			Message: comms.ToMessage(countBroadcast{counter.count}),
+			Public:  true,
+		}
+		return playerID
+	case "Crash":
+		gameChan <- game.GameRequest{
+			Players: []string{playerID},
+			Message: comms.ToMessage(countBroadcast{counter.count}),
+		}
+		panic("crashed")
+	}
+	return nil
+}
+
+var legacyCounterGame = game.LegacyGame{
+	NewStateFunc:      newLegacyCounter,
+	HandleRequestFunc: handleLegacyCounter,
+}
+
+func TestLegacyGameNewState(t *testing.T) {
+	if _, err := legacyCounterGame.NewState(gametest.NewLobby().Context()); err == nil {
+		t.Error("NewState's error wasn't returned")
+	}
+
+	lobby := gametest.NewLobby("a", "b")
+	state, err := legacyCounterGame.NewState(lobby.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.HandleRequest(lobby.Context(), "a", "Count", nil)
+	if len(lobby.Sent) != 1 || !reflect.DeepEqual(lobby.Sent[0].Players, []string{"a", "b"}) {
+		t.Errorf("Game wasn't created with the Context's players, it sent %v", lobby.Sent)
+	}
+}
+
+func TestLegacyGameHandleRequest(t *testing.T) {
+	lobby := gametest.NewLobby("a", "b")
+	state, err := legacyCounterGame.NewState(lobby.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, playerID := range []string{"a", "b"} {
+		if response := state.HandleRequest(lobby.Context(), playerID, "Count", nil); response != playerID {
+			t.Errorf("Got response %v, want %s", response, playerID)
+		}
+
+		want := gametest.Message{
+			Message: comms.ToMessage(countBroadcast{i + 1}),
+			Players: []string{"a", "b"},
+			Public:  true,
+		}
+		if len(lobby.Sent) != i+1 || !reflect.DeepEqual(lobby.Sent[i], want) {
+			t.Errorf("Sent %v, want %v last", lobby.Sent, want)
+		}
+	}
+}
+
+func TestLegacyGamePanic(t *testing.T) {
+	lobby := gametest.NewLobby("a", "b")
+	state, err := legacyCounterGame.NewState(lobby.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The panic is raised on the caller's goroutine, so the lobby can recover
+	// from it, after the messages sent before it are forwarded
+	defer func() {
+		if r := recover(); r != "crashed" {
+			t.Errorf("Recovered %v, want the game's panic", r)
+		}
+		if len(lobby.Sent) != 1 || !reflect.DeepEqual(lobby.Sent[0].Players, []string{"a"}) {
+			t.Errorf("Sent %v before panicking, want a message to a", lobby.Sent)
+		}
+	}()
+	state.HandleRequest(lobby.Context(), "a", "Crash", nil)
+	t.Error("HandleRequest didn't panic")
+}
@@ -0,0 +1,267 @@
+package game
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+)
+
+const (
+	DEFAULT_PROCESS_TIMEOUT = 2 * time.Second
+	MAX_PROCESS_LINE_LEN    = 1024 * 1024
+)
+
+// ProcessGame runs each game in its own subprocess, talking to it with
+// line-delimited JSON over its stdin and stdout, so a game crashing only ends
+// that game rather than the whole server.
+//
+// The server writes a NewState message when a game starts, and a
+// HandleRequest message for each message sent by a player:
+//
+//	{"type": "NewState", "contents": {"lobbyID": "...", "players": ["..."]}}
+//	{"type": "HandleRequest", "contents": {"playerID": "...", "messageType": "...", "contents": {}}}
+//
+// The game answers each with any number of GameRequest messages to send to
+// players (and spectators if public is set), and an End message if the game
+// has finished, followed by a Response. The Response message, if set, is sent
+// back to the player, and an error in the Response to NewState stops the game
+// from starting:
+//
+//	{"type": "GameRequest", "contents": {"players": ["..."], "public": false, "message": {"type": "...", "contents": {}}}}
+//	{"type": "End", "contents": {"winners": ["..."], "losers": ["..."], "draw": false, "scores": {}}}
+//	{"type": "Response", "contents": {"error": "...", "message": {"type": "...", "contents": {}}}}
+type ProcessGame struct {
+	Command []string
+
+	// Timeout is how long to wait for a Response before giving up on the game.
+	// Calls to the game are made on the lobby's goroutine, so while the game is
+	// busy the whole lobby waits, for up to Timeout, before the game's aborted.
+	Timeout time.Duration
+}
+
+type processMessage struct {
+	Type     string          `json:"type"`
+	Contents json.RawMessage `json:"contents"`
+}
+
+type processNewState struct {
+	LobbyID string   `json:"lobbyID"`
+	Players []string `json:"players"`
+}
+
+type processHandleRequest struct {
+	PlayerID    string      `json:"playerID"`
+	MessageType string      `json:"messageType"`
+	Contents    interface{} `json:"contents"`
+}
+
+type processGameRequest struct {
+	Players []string       `json:"players"`
+	Public  bool           `json:"public"`
+	Message *comms.Message `json:"message"`
+}
+
+type processResponse struct {
+	Error   string         `json:"error"`
+	Message *comms.Message `json:"message"`
+}
+
+func (g ProcessGame) NewState(ctx *Context) (State, error) {
+	if len(g.Command) == 0 {
+		return nil, errors.New("no command set for game")
+	}
+
+	cmd := exec.Command(g.Command[0], g.Command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start game: %s", err.Error())
+	}
+
+	timeout := g.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_PROCESS_TIMEOUT
+	}
+	state := &processState{
+		cmd:     cmd,
+		stdin:   stdin,
+		lines:   make(chan []byte),
+		done:    make(chan struct{}),
+		timeout: timeout,
+	}
+	go state.readLines(stdout)
+
+	response, err := state.call(ctx, "NewState", processNewState{
+		LobbyID: ctx.LobbyID(),
+		Players: ctx.Players(),
+	})
+	if err == nil && response.Error != "" {
+		err = errors.New(response.Error)
+	}
+	if err != nil {
+		state.OnEnd(ctx)
+		return nil, err
+	}
+	return state, nil
+}
+
+// processState is a game running in a subprocess
+type processState struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	lines   chan []byte
+	done    chan struct{}
+	endOnce sync.Once
+	timeout time.Duration
+}
+
+func (s *processState) HandleRequest(
+	ctx *Context,
+	playerID,
+	messageType string,
+	contents interface{},
+) interface{} {
+	response, err := s.call(ctx, "HandleRequest", processHandleRequest{
+		PlayerID:    playerID,
+		MessageType: messageType,
+		Contents:    contents,
+	})
+	if err != nil {
+		ctx.Abort(fmt.Sprintf("Game crashed: %s", err.Error()))
+		return nil
+	}
+
+	if response.Error != "" {
+		return comms.ErrorResponse{Reason: response.Error}
+	}
+	if response.Message != nil {
+		return *response.Message
+	}
+	return nil
+}
+
+// OnEnd kills the game's process
+func (s *processState) OnEnd(ctx *Context) {
+	s.endOnce.Do(func() {
+		close(s.done)
+		s.stdin.Close()
+		s.cmd.Process.Kill()
+		go s.cmd.Wait()
+	})
+}
+
+// call sends a message to the game, forwarding GameRequests to the Context
+// until the game responds.
+func (s *processState) call(
+	ctx *Context,
+	messageType string,
+	contents interface{},
+) (processResponse, error) {
+	var response processResponse
+
+	encodedContents, err := json.Marshal(contents)
+	if err != nil {
+		return response, err
+	}
+	line, err := json.Marshal(processMessage{
+		Type:     messageType,
+		Contents: encodedContents,
+	})
+	if err != nil {
+		return response, err
+	}
+	// The write blocks if the game stops reading its stdin, so it's bounded by
+	// the timeout too
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	written := make(chan error, 1)
+	go func() {
+		_, err := s.stdin.Write(append(line, '\n'))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			return response, err
+		}
+	case <-timer.C:
+		s.cmd.Process.Kill()
+		return response, errors.New("timed out writing to game")
+	}
+
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				return response, errors.New("game process exited")
+			}
+
+			var message processMessage
+			if err := json.Unmarshal(line, &message); err != nil {
+				return response, fmt.Errorf("invalid message from game: %s", err.Error())
+			}
+
+			switch message.Type {
+			case "GameRequest":
+				var req processGameRequest
+				if err := json.Unmarshal(message.Contents, &req); err != nil || req.Message == nil {
+					return response, errors.New("invalid GameRequest from game")
+				}
+				ctx.lobby.SendGameMessage(*req.Message, req.Players, req.Public)
+
+			case "End":
+				var result Result
+				if err := json.Unmarshal(message.Contents, &result); err != nil {
+					return response, errors.New("invalid End from game")
+				}
+				ctx.End(result)
+
+			case "Response":
+				if err := json.Unmarshal(message.Contents, &response); err != nil {
+					return response, errors.New("invalid Response from game")
+				}
+				return response, nil
+
+			default:
+				return response, fmt.Errorf("unknown message type %s from game", message.Type)
+			}
+
+		case <-timer.C:
+			s.cmd.Process.Kill()
+			return response, errors.New("timed out waiting for game")
+		}
+	}
+}
+
+// readLines reads lines from the game's stdout until it exits or the game ends
+func (s *processState) readLines(stdout io.Reader) {
+	defer close(s.lines)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 4096), MAX_PROCESS_LINE_LEN)
+	for scanner.Scan() {
+		line := make([]byte, len(scanner.Bytes()))
+		copy(line, scanner.Bytes())
+
+		select {
+		case s.lines <- line:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package game_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game/gametest"
+)
+
+const PROCESS_TEST_TIMEOUT = 500 * time.Millisecond
+
+// TestHelperProcess isn't a real test, it's the game run by the ProcessGame
+// tests, which behaves as set by the argument after "--".
+func TestHelperProcess(t *testing.T) {
+	mode := ""
+	for i, arg := range os.Args {
+		if arg == "--" && i+1 < len(os.Args) {
+			mode = os.Args[i+1]
+		}
+	}
+	if mode == "" {
+		return
+	}
+
+	write := func(messageType string, contents interface{}) {
+		line, _ := json.Marshal(comms.Message{Type: messageType, Contents: contents})
+		fmt.Println(string(line))
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var message struct {
+			Type     string
+			Contents struct {
+				Players     []string
+				PlayerID    string
+				MessageType string
+			}
+		}
+		json.Unmarshal(scanner.Bytes(), &message)
+
+		switch {
+		case message.Type == "NewState" && mode == "refuse":
+			write("Response", map[string]string{"error": "Not enough players"})
+		case message.Type == "NewState":
+			write("Response", map[string]string{})
+		case mode == "stuck":
+			// Keeps reading without ever responding
+		case mode == "crash":
+			os.Exit(1)
+		default:
+			write("GameRequest", map[string]interface{}{
+				"players": []string{message.Contents.PlayerID},
+				"public":  true,
+				"message": comms.Message{Type: "Echo", Contents: message.Contents.MessageType},
+			})
+			write("Response", map[string]interface{}{
+				"message": comms.Message{Type: "Echoed"},
+			})
+		}
+	}
+	os.Exit(0)
+}
+
+func newTestProcessGame(mode string) game.ProcessGame {
+	return game.ProcessGame{
+		Command: []string{os.Args[0], "-test.run=TestHelperProcess", "--", mode},
+		Timeout: PROCESS_TEST_TIMEOUT,
+	}
+}
+
+func startTestProcessGame(t *testing.T, mode string) (*gametest.Lobby, game.State) {
+	lobby := gametest.NewLobby("a", "b")
+	state, err := newTestProcessGame(mode).NewState(lobby.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		state.(game.Ender).OnEnd(lobby.Context())
+	})
+	return lobby, state
+}
+
+func TestProcessGameHandleRequest(t *testing.T) {
+	lobby, state := startTestProcessGame(t, "echo")
+
+	response := state.HandleRequest(lobby.Context(), "a", "Ping", nil)
+	if response != (comms.Message{Type: "Echoed"}) {
+		t.Errorf("Got response %v, want an Echoed message", response)
+	}
+
+	want := []gametest.Message{{
+		Message: comms.Message{Type: "Echo", Contents: "Ping"},
+		Players: []string{"a"},
+		Public:  true,
+	}}
+	if !reflect.DeepEqual(lobby.Sent, want) {
+		t.Errorf("Sent %v, want %v", lobby.Sent, want)
+	}
+	if lobby.AbortReason != "" {
+		t.Errorf("Game aborted with %q", lobby.AbortReason)
+	}
+}
+
+func TestProcessGameNewStateError(t *testing.T) {
+	lobby := gametest.NewLobby("a", "b")
+	_, err := newTestProcessGame("refuse").NewState(lobby.Context())
+	if err == nil || err.Error() != "Not enough players" {
+		t.Errorf("NewState returned %v, want the game's error", err)
+	}
+}
+
+func TestProcessGameTimeout(t *testing.T) {
+	lobby, state := startTestProcessGame(t, "stuck")
+
+	start := time.Now()
+	if response := state.HandleRequest(lobby.Context(), "a", "Ping", nil); response != nil {
+		t.Errorf("Got response %v from a stuck game", response)
+	}
+	if elapsed := time.Since(start); elapsed > 2*PROCESS_TEST_TIMEOUT {
+		t.Errorf("Waited %s for a stuck game, want at most %s", elapsed, PROCESS_TEST_TIMEOUT)
+	}
+	if !strings.Contains(lobby.AbortReason, "timed out") {
+		t.Errorf("Game aborted with %q, want a timeout", lobby.AbortReason)
+	}
+}
+
+func TestProcessGameCrash(t *testing.T) {
+	lobby, state := startTestProcessGame(t, "crash")
+
+	if response := state.HandleRequest(lobby.Context(), "a", "Ping", nil); response != nil {
+		t.Errorf("Got response %v from a crashed game", response)
+	}
+	if !strings.Contains(lobby.AbortReason, "exited") {
+		t.Errorf("Game aborted with %q, want the process exiting", lobby.AbortReason)
+	}
+
+	// The lobby may end the game more than once, e.g. when it's aborted while
+	// shutting down
+	state.(game.Ender).OnEnd(lobby.Context())
+}
@@ -0,0 +1,35 @@
+package game
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]Game)
+)
+
+// Register makes a game available under the given name, so it can be
+// referenced from the games section of the config. Games linked into the
+// binary should call this from an init function.
+func Register(name string, g Game) {
+	if g == nil {
+		panic(fmt.Sprintf("Game %s registered as nil", name))
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("Game %s is already registered", name))
+	}
+	registry[name] = g
+}
+
+// Lookup returns the game registered under the given name.
+func Lookup(name string) (Game, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	g, ok := registry[name]
+	return g, ok
+}
@@ -0,0 +1,41 @@
+package game
+
+import "testing"
+
+type registryTestGame struct{}
+
+func (registryTestGame) NewState(ctx *Context) (State, error) {
+	return nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	Register("test/registry", registryTestGame{})
+	if g, ok := Lookup("test/registry"); !ok || g != (registryTestGame{}) {
+		t.Errorf("Lookup returned %v, %v for a registered game", g, ok)
+	}
+	if g, ok := Lookup("test/unregistered"); ok || g != nil {
+		t.Errorf("Lookup returned %v, %v for an unregistered game", g, ok)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	Register("test/duplicate", registryTestGame{})
+	tests := []struct {
+		name     string
+		gameName string
+		game     Game
+	}{
+		{"duplicate name", "test/duplicate", registryTestGame{}},
+		{"nil game", "test/nil", nil},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: Register didn't panic", test.name)
+				}
+			}()
+			Register(test.gameName, test.game)
+		}()
+	}
+}
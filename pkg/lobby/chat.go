@@ -0,0 +1,105 @@
+package lobby
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/ratelimit"
+)
+
+const (
+	MAX_CHAT_MESSAGE_LEN = 500
+	MAX_CHAT_HISTORY     = 50
+
+	// Players can send a burst of CHAT_BURST messages, then CHAT_RATE a second
+	CHAT_RATE  = 1
+	CHAT_BURST = 5
+)
+
+func newChatLimiter() *ratelimit.Bucket {
+	return ratelimit.NewBucket(CHAT_RATE, CHAT_BURST)
+}
+
+// chat sends a player's chat message to the lobby, their team, or the player
+// they're whispering to
+func (l *Lobby) chat(playerID string, req LobbyChatMessageRequest) error {
+	p, ok := l.players[playerID]
+	if !ok {
+		return errors.New("Player is not in the lobby")
+	}
+
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		return errors.New("Chat messages can't be empty")
+	}
+	if utf8.RuneCountInString(text) > MAX_CHAT_MESSAGE_LEN {
+		return fmt.Errorf(
+			"Chat messages must be at most %d characters", MAX_CHAT_MESSAGE_LEN)
+	}
+	if !p.chatLimiter.Allow() {
+		return errors.New("Sending chat messages too quickly")
+	}
+
+	message := LobbyChatBroadcast{
+		SenderID:  playerID,
+		Sender:    l.playerInfo(playerID),
+		Text:      text,
+		Timestamp: time.Now(),
+	}
+
+	switch {
+	case req.To != "":
+		if _, ok := l.players[req.To]; !ok {
+			return fmt.Errorf("Player %s is not in the lobby", req.To)
+		}
+		message.To = req.To
+		l.sendToPlayer(req.To, message)
+		if req.To != playerID {
+			l.sendToPlayer(playerID, message)
+		}
+
+	case req.Team:
+		team := l.team(playerID)
+		if team == "" {
+			return errors.New("Player is not in a team")
+		}
+		message.Team = team
+		for _, player := range l.GamePlayers {
+			if l.team(player) == team {
+				l.sendToPlayer(player, message)
+			}
+		}
+
+	default:
+		l.chatHistory = append(l.chatHistory, message)
+		if len(l.chatHistory) > MAX_CHAT_HISTORY {
+			l.chatHistory = l.chatHistory[1:]
+		}
+		l.broadcastMessageToLobby(message)
+	}
+	return nil
+}
+
+// team returns the player's team in the running game, if it has teams
+func (l *Lobby) team(playerID string) string {
+	teamed, ok := l.GameState.(game.Teamed)
+	if !ok || !l.isInGame(playerID) {
+		return ""
+	}
+
+	var team string
+	l.recoverGamePanic(playerID, func() {
+		team = teamed.Team(playerID)
+	})
+	return team
+}
+
+func (l *Lobby) chatHistoryResponse() LobbyChatHistoryResponse {
+	messages := make([]LobbyChatBroadcast, len(l.chatHistory))
+	copy(messages, l.chatHistory)
+	return LobbyChatHistoryResponse{Messages: messages}
+}
@@ -0,0 +1,399 @@
+package lobby
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+
+	"go.uber.org/zap"
+)
+
+// startGameRequest handles a host's request to start a game, aborting any
+// game that's still running
+func (l *Lobby) startGameRequest(
+	req comms.Request,
+	name string,
+	g game.Game,
+	players []string,
+) {
+	if l.draining {
+		req.Reply(LobbyStartGameResponse{
+			Status: false,
+			Reason: "The server is shutting down",
+		})
+		return
+	}
+	if err := l.checkCanStart(g, players); err != nil {
+		req.Reply(LobbyStartGameResponse{
+			Status: false,
+			Reason: err.Error(),
+		})
+		return
+	}
+
+	if l.GameState != nil {
+		l.Log.Info(fmt.Sprintf(
+			"Aborted game of %s in lobby %s for a new game", l.GameName, l.LobbyID))
+		l.broadcastMessageToLobby(GameAbortedBroadcast{
+			Game:   l.GameName,
+			Reason: "The host started a new game",
+		})
+		l.endGame()
+	}
+
+	if err := l.startGame(name, g, players); err == nil {
+		// Tell players that the game has started
+		req.Reply(LobbyStartGameResponse{
+			Status: true,
+		})
+		l.broadcastMessageToLobby(l.startGameBroadcast())
+		l.resetReady()
+		l.Log.Info(fmt.Sprintf(
+			"Started new game of %s in lobby %s", l.GameName, l.LobbyID))
+
+		if starter, ok := l.GameState.(game.Starter); ok {
+			l.callGame(req.PlayerID, func() {
+				starter.OnStart(l.GameContext)
+			})
+		}
+	} else {
+		req.Reply(LobbyStartGameResponse{
+			Status: false,
+			Reason: err.Error(),
+		})
+	}
+}
+
+// checkCanStart returns an error if the game can't be started with the given
+// players, because there are too few or many of them or they aren't ready
+func (l *Lobby) checkCanStart(g game.Game, players []string) error {
+	if limits, ok := g.(game.PlayerLimits); ok {
+		var min, max int
+		l.recoverGamePanic("", func() {
+			min, max = limits.MinPlayers(), limits.MaxPlayers()
+		})
+		if min > 0 && len(players) < min {
+			return fmt.Errorf("The game needs at least %d players", min)
+		}
+		if max > 0 && len(players) > max {
+			return fmt.Errorf("The game allows at most %d players", max)
+		}
+	}
+
+	if l.Settings.RequireReady {
+		if notReady := l.notReadyPlayers(players); len(notReady) > 0 {
+			return fmt.Errorf(
+				"Players aren't ready: %s", strings.Join(notReady, ", "))
+		}
+	}
+	return nil
+}
+
+// startGame creates a new game between the given players
+func (l *Lobby) startGame(name string, g game.Game, players []string) error {
+	l.GameName = name
+	l.GamePlayers = append([]string(nil), players...)
+	l.GameContext = game.NewContext(gameLobby{l})
+	l.gameLeftPlayers = make(map[string]bool)
+
+	var (
+		state game.State
+		err   error
+	)
+	if !l.recoverGamePanic("", func() {
+		state, err = g.NewState(l.GameContext)
+	}) {
+		err = errors.New("the game crashed while starting")
+	}
+	if err != nil {
+		l.clearGame()
+		return err
+	}
+	l.GameState = state
+	gameStarts.WithLabel(name).Inc()
+	l.lastGameName = name
+	l.lastGamePlayers = l.GamePlayers
+
+	if ticker, ok := state.(game.Ticker); ok {
+		var rate time.Duration
+		l.recoverGamePanic("", func() {
+			rate = ticker.TickRate()
+		})
+		if rate > 0 {
+			l.scheduleTimer(rate, true, func() {
+				ticker.OnTick(l.GameContext)
+			})
+		}
+	}
+	return nil
+}
+
+// playerLeftGame tells the running game that one of its players has left
+func (l *Lobby) playerLeftGame(player PlayerInfo) {
+	playerID := player.PlayerID
+	if !l.isInGame(playerID) || l.gameLeftPlayers[playerID] {
+		return
+	}
+	l.gameLeftPlayers[playerID] = true
+
+	l.broadcastMessageToLobbyExcept(LobbyPlayerLeftGameBroadcast{
+		PlayerID: playerID,
+		Player:   player,
+		Game:     l.GameName,
+	}, playerID)
+
+	if handler, ok := l.GameState.(game.PlayerLeftHandler); ok {
+		l.callGame(playerID, func() {
+			handler.OnPlayerLeft(l.GameContext, playerID)
+		})
+	}
+}
+
+// playerRejoinedGame tells the running game that a player who left it has
+// rejoined the lobby
+func (l *Lobby) playerRejoinedGame(playerID string) {
+	if !l.isInGame(playerID) || !l.gameLeftPlayers[playerID] {
+		return
+	}
+	delete(l.gameLeftPlayers, playerID)
+
+	l.broadcastMessageToLobbyExcept(LobbyPlayerRejoinedGameBroadcast{
+		PlayerID: playerID,
+		Player:   l.playerInfo(playerID),
+		Game:     l.GameName,
+	}, playerID)
+
+	if handler, ok := l.GameState.(game.PlayerRejoinedHandler); ok {
+		l.callGame(playerID, func() {
+			handler.OnPlayerRejoined(l.GameContext, playerID)
+		})
+	}
+}
+
+// startGameBroadcast tells players which game is running, and who's playing it
+func (l *Lobby) startGameBroadcast() LobbyStartGameBroadcast {
+	players := make([]PlayerInfo, len(l.GamePlayers))
+	for i, playerID := range l.GamePlayers {
+		players[i] = l.playerInfo(playerID)
+	}
+	return LobbyStartGameBroadcast{
+		Game:    l.GameName,
+		Players: players,
+	}
+}
+
+// isInGame returns true if the player is one of the running game's players
+func (l *Lobby) isInGame(playerID string) bool {
+	if l.GameState == nil {
+		return false
+	}
+	for _, player := range l.GamePlayers {
+		if player == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+// callGame runs fn, which calls into the running game on behalf of a player,
+// tearing down the game afterwards if it ended, was aborted or panicked
+func (l *Lobby) callGame(playerID string, fn func()) {
+	if !l.recoverGamePanic(playerID, fn) {
+		l.gameAbortReason = "The game crashed"
+	}
+
+	if reason := l.gameAbortReason; reason != "" {
+		l.gameAbortReason = ""
+		l.Log.Info(fmt.Sprintf(
+			"Aborted game of %s in lobby %s: %s", l.GameName, l.LobbyID, reason))
+		l.broadcastMessageToLobby(GameAbortedBroadcast{
+			Game:   l.GameName,
+			Reason: reason,
+		})
+		l.endGame()
+	} else if result := l.gameResult; result != nil {
+		l.Log.Info(fmt.Sprintf(
+			"Game of %s ended in lobby %s", l.GameName, l.LobbyID))
+		l.broadcastMessageToLobby(LobbyGameEndedBroadcast{
+			Game:   l.GameName,
+			Result: *result,
+		})
+		l.endGame()
+	}
+
+	if l.draining && l.GameState == nil {
+		l.close()
+	}
+}
+
+// endGame tears down the current game, if there is one
+func (l *Lobby) endGame() {
+	if l.GameState == nil {
+		return
+	}
+
+	if ender, ok := l.GameState.(game.Ender); ok {
+		l.recoverGamePanic("", func() {
+			ender.OnEnd(l.GameContext)
+		})
+	}
+	l.clearGame()
+}
+
+// recoverGamePanic runs fn, which calls into a game, recovering and logging
+// any panic so that a broken game can't take down the lobby. It returns false
+// if fn panicked.
+func (l *Lobby) recoverGamePanic(playerID string, fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.Log.Error(
+				"Recovered from game panic",
+				zap.String("lobbyID", l.LobbyID),
+				zap.String("game", l.GameName),
+				zap.String("playerID", playerID),
+				zap.Any("panic", r),
+				zap.Stack("stack"),
+			)
+			ok = false
+		}
+	}()
+
+	fn()
+	return true
+}
+
+func (l *Lobby) clearGame() {
+	for id := range l.timers {
+		l.cancelTimer(id)
+	}
+	l.gameAbortReason = ""
+	l.gameResult = nil
+	l.GameName = ""
+	l.GameState = nil
+	l.GameContext = nil
+	l.GamePlayers = nil
+	l.gameLeftPlayers = nil
+}
+
+// gameTimer is a timer scheduled by the running game
+type gameTimer struct {
+	fn     func()
+	repeat bool
+	stop   func()
+}
+
+// scheduleTimer calls fn through callGame after d, or every d if repeat is
+// set. Timers fire onto timerChannel so fn runs on the lobby's goroutine.
+func (l *Lobby) scheduleTimer(d time.Duration, repeat bool, fn func()) game.TimerID {
+	l.nextTimerID++
+	id := l.nextTimerID
+	t := &gameTimer{fn: fn, repeat: repeat}
+
+	if repeat {
+		ticker := time.NewTicker(d)
+		stop := make(chan struct{})
+		t.stop = func() {
+			ticker.Stop()
+			close(stop)
+		}
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					select {
+					case l.timerChannel <- id:
+					case <-stop:
+						return
+					case <-l.done:
+						return
+					}
+				case <-stop:
+					return
+				case <-l.done:
+					return
+				}
+			}
+		}()
+	} else {
+		timer := time.AfterFunc(d, func() {
+			select {
+			case l.timerChannel <- id:
+			case <-l.done:
+			}
+		})
+		t.stop = func() { timer.Stop() }
+	}
+
+	l.timers[id] = t
+	return id
+}
+
+func (l *Lobby) cancelTimer(id game.TimerID) {
+	if t, ok := l.timers[id]; ok {
+		t.stop()
+		delete(l.timers, id)
+	}
+}
+
+// fireTimer runs a timer which has fired, ignoring timers which were cancelled
+// after firing but before reaching the lobby's goroutine
+func (l *Lobby) fireTimer(id game.TimerID) {
+	t, ok := l.timers[id]
+	if !ok {
+		return
+	}
+	if !t.repeat {
+		delete(l.timers, id)
+	}
+	l.callGame("", t.fn)
+}
+
+// gameLobby gives a Lobby's running game access to it, through game.Context
+type gameLobby struct {
+	lobby *Lobby
+}
+
+func (g gameLobby) ID() string {
+	return g.lobby.LobbyID
+}
+
+func (g gameLobby) Players() []string {
+	players := make([]string, len(g.lobby.GamePlayers))
+	copy(players, g.lobby.GamePlayers)
+	return players
+}
+
+func (g gameLobby) SendGameMessage(message comms.Message, players []string, public bool) {
+	if public {
+		players = append(players, g.lobby.getSpectatorsList()...)
+	}
+	g.lobby.broadcastMessageToPlayers(
+		comms.Message{
+			Type:     "Game/" + message.Type,
+			Contents: message.Contents,
+		},
+		players,
+	)
+}
+
+func (g gameLobby) AbortGame(reason string) {
+	g.lobby.gameAbortReason = reason
+}
+
+func (g gameLobby) EndGame(result game.Result) {
+	if g.lobby.gameResult == nil {
+		g.lobby.gameResult = &result
+	}
+}
+
+func (g gameLobby) ScheduleTimer(d time.Duration, repeat bool, fn func()) game.TimerID {
+	return g.lobby.scheduleTimer(d, repeat, fn)
+}
+
+func (g gameLobby) CancelTimer(id game.TimerID) {
+	g.lobby.cancelTimer(id)
+}
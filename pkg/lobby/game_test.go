@@ -0,0 +1,120 @@
+package lobby
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+	"github.com/google/uuid"
+)
+
+// testGame passes the IDs of players who send it requests to requests
+type testGame struct {
+	requests chan string
+}
+
+func newTestGame() testGame {
+	return testGame{requests: make(chan string, 10)}
+}
+
+func (g testGame) NewState(ctx *game.Context) (game.State, error) {
+	return g, nil
+}
+
+func (g testGame) HandleRequest(
+	ctx *game.Context,
+	playerID, messageType string,
+	contents interface{},
+) interface{} {
+	g.requests <- playerID
+	return nil
+}
+
+func TestOnlyGamePlayersSendGameMessages(t *testing.T) {
+	g := newTestGame()
+	host, player, late := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	l := newTestLobby(t, host, map[string]game.Game{"test": g})
+	hostConn, playerConn, lateConn := newTestConn(t, 100), newTestConn(t, 100), newTestConn(t, 100)
+	joinTestLobby(t, l, host, hostConn)
+	joinTestLobby(t, l, player, playerConn)
+
+	sendTestRequest(l, host, hostConn, "LobbyStartGameRequest", map[string]interface{}{"game": "test"})
+	var started LobbyStartGameResponse
+	expectMessage(t, hostConn, &started)
+	if !started.Status {
+		t.Fatalf("Game didn't start: %s", started.Reason)
+	}
+
+	// Players who joined mid-game aren't playing
+	joinTestLobby(t, l, late, lateConn)
+	sendTestRequest(l, late, lateConn, "Game/Move", nil)
+	expectMessage(t, lateConn, &comms.ErrorResponse{})
+
+	sendTestRequest(l, player, playerConn, "Game/Move", nil)
+	expectGameRequest(t, g, player)
+
+	// Nor are players who have been kicked, but whose requests are still queued
+	sendTestRequest(l, host, hostConn, "LobbyKickPlayerRequest", map[string]interface{}{"playerID": player})
+	sendTestRequest(l, player, playerConn, "Game/Move", nil)
+	sendTestRequest(l, host, hostConn, "Game/Move", nil)
+	expectGameRequest(t, g, host)
+}
+
+func TestStartingGameAbortsRunningGame(t *testing.T) {
+	host := uuid.NewString()
+	l := newTestLobby(t, host, map[string]game.Game{"test": newTestGame()})
+	conn := newTestConn(t, 100)
+	joinTestLobby(t, l, host, conn)
+
+	sendTestRequest(l, host, conn, "LobbyStartGameRequest", map[string]interface{}{"game": "test"})
+	expectMessage(t, conn, &LobbyStartGameBroadcast{})
+	sendTestRequest(l, host, conn, "LobbyStartGameRequest", map[string]interface{}{"game": "test"})
+	var aborted GameAbortedBroadcast
+	expectMessage(t, conn, &aborted)
+	if aborted.Game != "test" {
+		t.Errorf("Aborted game was %q, want test", aborted.Game)
+	}
+	expectMessage(t, conn, &LobbyStartGameBroadcast{})
+}
+
+func TestRematchRefusedForSpectators(t *testing.T) {
+	host, player := uuid.NewString(), uuid.NewString()
+	l := newTestLobby(t, host, map[string]game.Game{"test": newTestGame()})
+	hostConn, playerConn := newTestConn(t, 100), newTestConn(t, 100)
+	joinTestLobby(t, l, host, hostConn)
+	joinTestLobby(t, l, player, playerConn)
+	sendTestRequest(l, host, hostConn, "LobbyStartGameRequest", map[string]interface{}{"game": "test"})
+	expectMessage(t, hostConn, &LobbyStartGameBroadcast{})
+
+	// The player rejoins to spectate
+	l.Leave(playerConn)
+	spectatorConn := newTestConn(t, 100)
+	spectatorConn.PlayerID = player
+	if err := l.Join(spectatorConn, LobbyJoinRequest{
+		PlayerID:  player,
+		LobbyID:   l.LobbyID,
+		Spectator: true,
+	}, Profile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	sendTestRequest(l, host, hostConn, "LobbyRematchRequest", nil)
+	var refused comms.ErrorResponse
+	expectMessage(t, hostConn, &refused)
+	if !strings.Contains(refused.Reason, "spectating") {
+		t.Errorf("Rematch refused because %q, want the player is spectating", refused.Reason)
+	}
+}
+
+func expectGameRequest(t *testing.T, g testGame, playerID string) {
+	select {
+	case sender := <-g.requests:
+		if sender != playerID {
+			t.Errorf("Game was sent a request from %s, want %s", sender, playerID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Game wasn't sent a request from %s", playerID)
+	}
+}
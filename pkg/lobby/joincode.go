@@ -0,0 +1,36 @@
+package lobby
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+const (
+	JOIN_CODE_LEN = 5
+	// JOIN_CODE_ALPHABET leaves out I and O, which are easily mistaken for 1
+	// and 0
+	JOIN_CODE_ALPHABET = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	// MAX_JOIN_CODE_ATTEMPTS is how many random codes are tried before giving
+	// up on finding one which isn't taken
+	MAX_JOIN_CODE_ATTEMPTS = 20
+)
+
+// newJoinCode generates a random join code
+func newJoinCode() (string, error) {
+	max := big.NewInt(int64(len(JOIN_CODE_ALPHABET)))
+	code := make([]byte, JOIN_CODE_LEN)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = JOIN_CODE_ALPHABET[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normaliseJoinCode tidies up a join code typed in by a player
+func normaliseJoinCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -1,10 +1,12 @@
 package lobby
 
 import (
+	"errors"
 	"fmt"
-	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
 	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
@@ -20,6 +22,12 @@ type Player struct {
 	LobbyID  string
 }
 
+var (
+	ErrLobbyClosed = errors.New("lobby has closed")
+	ErrJoinRefused = errors.New("lobby refused join")
+	ErrNoJoinCodes = errors.New("unable to allocate a unique join code")
+)
+
 func IsValidPlayerID(playerID string) bool {
 	_, err := uuid.Parse(playerID)
 	return err == nil
@@ -29,163 +37,483 @@ type Lobby struct {
 	Log     *zap.Logger
 	LobbyID string
 	// Host is the host's player ID
-	Host string
+	Host     string
+	Settings LobbySettings
+	// JoinCode is a short code which can be used to join the lobby instead of
+	// its ID, allocated when the lobby is put in a LobbyStore
+	JoinCode string
 
 	// State of the current game
-	GameName        string
-	GameState       interface{}
-	GameRequestChan chan game.GameRequest
+	GameName    string
+	GameState   game.State
+	GameContext *game.Context
+	GamePlayers []string
+
+	// gameLeftPlayers stores the players who have left the running game
+	gameLeftPlayers map[string]bool
+
+	// gameAbortReason is set when the running game asks to be aborted
+	gameAbortReason string
+
+	// gameResult is set when the running game reports that it has ended
+	gameResult *game.Result
+
+	// The last game started, which can be restarted by a LobbyRematchRequest
+	lastGameName    string
+	lastGamePlayers []string
+
+	// players stores the players in the lobby by ID, including those who have
+	// disconnected but can still resume their session. It's only accessed
+	// from the LobbyRequestHandler goroutine.
+	players       map[string]*lobbyPlayer
+	nextJoinOrder int
+
+	// banned stores the IDs of players who can't rejoin the lobby
+	banned map[string]bool
 
-	// PlayerIDToConnStore stores a mapping of Player IDs to Socket connections
-	PlayerIDToConnStore map[string]*comms.ConnectionWrapper
+	// chatHistory stores the latest chat messages sent to the whole lobby
+	chatHistory []LobbyChatBroadcast
 
 	// RequestChannel stores a channel of incoming Requests
 	RequestChannel chan comms.Request
+
+	// Timers scheduled by the running game, which fire onto timerChannel
+	timers       map[game.TimerID]*gameTimer
+	timerChannel chan game.TimerID
+	nextTimerID  game.TimerID
+
+	// draining is set once the server is shutting down, so the lobby closes
+	// when its game ends
+	draining bool
+
+	// closing is set once the lobby should stop handling requests
+	closing bool
+
+	// done is closed once LobbyRequestHandler has returned
+	done chan struct{}
+
+	// summary holds a LobbySummary, which is safe to read from any goroutine
+	summary atomic.Value
 }
 
-func (l *Lobby) Close() {
-	l.broadcastMessageToLobby(LobbyClosedBroadcast{})
-	close(l.RequestChannel)
-	if l.GameRequestChan != nil {
-		close(l.GameRequestChan)
-	}
+// LobbySummary is a snapshot of a lobby's state
+type LobbySummary struct {
+	LobbyID  string `json:"lobbyID"`
+	JoinCode string `json:"joinCode"`
+	Name     string `json:"name"`
+	Public   bool   `json:"public"`
+	Game     string `json:"game"`
+	// Players doesn't include Spectators
+	Players    int `json:"players"`
+	Spectators int `json:"spectators"`
+	// MaxPlayers is 0 if there's no limit
+	MaxPlayers        int  `json:"maxPlayers"`
+	PasswordProtected bool `json:"passwordProtected"`
+	Locked            bool `json:"locked"`
+	// RunningGame is the name of the running game, or empty if there isn't one
+	RunningGame string `json:"runningGame"`
+	InProgress  bool   `json:"inProgress"`
 }
 
-func (l *Lobby) LobbyRequestHandler(config *config.Config) {
-	for {
-		req := <-l.RequestChannel
-
-		switch req.Message.Type {
-		case "PlayerJoinedEvent", "PlayerLeftEvent":
-			// New player joins the lobby
-			players := l.getPlayersList()
-			sort.Strings(players)
-
-			l.broadcastMessageToLobby(LobbyPlayerListBroadcast{
-				PlayerIDs: players,
-			})
-
-		case "LobbyStartGameRequest":
-			// Host starts a Game
-			var contents LobbyStartGameRequest
-			err := mapstructure.Decode(req.Message.Contents, &contents)
-			if err != nil {
-				req.Error("Unable to parse LobbyStartGameRequest", err)
-				continue
-			}
+// NewLobby constructs a new Lobby, which handles requests once
+// LobbyRequestHandler is running.
+func NewLobby(
+	log *zap.Logger,
+	lobbyID, host string,
+	settings LobbySettings,
+	channelBufferLen int,
+) *Lobby {
+	l := &Lobby{
+		Log:            log,
+		LobbyID:        lobbyID,
+		Host:           host,
+		Settings:       settings,
+		players:        make(map[string]*lobbyPlayer),
+		banned:         make(map[string]bool),
+		RequestChannel: make(chan comms.Request, channelBufferLen),
+		timers:         make(map[game.TimerID]*gameTimer),
+		timerChannel:   make(chan game.TimerID, channelBufferLen),
+		done:           make(chan struct{}),
+	}
+	l.updateSummary()
+	lobbiesCreated.Inc()
+	return l
+}
 
-			if req.PlayerID == l.Host {
-				if gamePlugin, ok := config.Games[contents.Game]; ok {
-					state, err := gamePlugin.NewState(l.getPlayersList())
-					if err == nil {
-						// Save game state to Lobby
-						l.GameName = contents.Game
-						l.GameState = state
-						l.GameRequestChan = make(chan game.GameRequest)
-
-						// Run a handler to handle requests from the GameService
-						go l.GameRequestHandler()
-
-						// Tell players that the game has started
-						req.ConnChannel <- comms.ToMessage(LobbyStartGameResponse{
-							Status: true,
-						})
-						l.broadcastMessageToLobby(
-							LobbyStartGameBroadcast{Game: l.GameName})
-						l.Log.Info(fmt.Sprintf(
-							"Started new game of %s in lobby %s", l.GameName, l.LobbyID))
-					} else {
-						req.ConnChannel <- comms.ToMessage(LobbyStartGameResponse{
-							Status: false,
-							Reason: err.Error(),
-						})
-					}
-				} else {
-					req.Error("Invalid game name", nil)
-				}
-			} else {
-				req.Error(fmt.Sprintf(
-					"Only the host can start a game (player %s, host %s)",
-					req.PlayerID,
-					l.Host,
-				), nil)
-			}
+// Send passes a request to the lobby, returning false if the lobby has closed.
+func (l *Lobby) Send(req comms.Request) bool {
+	select {
+	case l.RequestChannel <- req:
+		return true
+	case <-l.done:
+		return false
+	}
+}
 
-		default:
-			// Route non-lobby-related messages
-			typeComponents := strings.Split(req.Message.Type, "/")
-
-			switch typeComponents[0] {
-			case "Game":
-				if len(typeComponents) != 2 {
-					req.Error(fmt.Sprintf(
-						"%s is an invalid Game message type, it should be of the format "+
-							"'Game/<game-message-type>'",
-						req.Message.Type,
-					), nil)
-				} else if l.GameState == nil {
-					req.Error("Must set LobbyStartGameRequest first", nil)
-				} else {
-					errMessage := config.Games[l.GameName].HandleRequest(
-						l.GameRequestChan, l.GameState, req.PlayerID,
-						typeComponents[1], req.Message.Contents)
-					if errMessage != nil {
-						req.ConnChannel <- comms.ToMessage(errMessage)
-					}
-				}
+// Join asks the lobby to add a player's connection, resuming their session if
+// they're already in the lobby. It returns ErrJoinRefused if the lobby turned
+// them away, having already sent them the reason.
+func (l *Lobby) Join(conn *comms.ConnectionWrapper, req LobbyJoinRequest, profile Profile) error {
+	joined := make(chan bool, 1)
+	if !l.Send(comms.Request{
+		Conn:     conn,
+		PlayerID: req.PlayerID,
+		Message: comms.ToMessage(PlayerJoinedEvent{
+			conn:        conn,
+			password:    req.Password,
+			spectator:   req.Spectator,
+			profile:     profile,
+			resumeToken: req.ResumeToken,
+			joined:      joined,
+		}),
+	}) {
+		return ErrLobbyClosed
+	}
 
-			default:
-				req.Error(
-					fmt.Sprintf("%s is an invalid message type", req.Message.Type), nil)
-			}
+	select {
+	case ok := <-joined:
+		if !ok {
+			return ErrJoinRefused
 		}
+		return nil
+	case <-l.done:
+		return ErrLobbyClosed
 	}
 }
 
-func (l *Lobby) broadcastMessageToLobby(contents interface{}) {
-	for _, conn := range l.PlayerIDToConnStore {
-		conn.WriteChannel <- comms.ToMessage(contents)
-	}
+// Leave removes a player's connection from the lobby at their request.
+func (l *Lobby) Leave(conn *comms.ConnectionWrapper) {
+	l.Send(comms.Request{
+		PlayerID: conn.PlayerID,
+		Message:  comms.ToMessage(PlayerLeftEvent{conn: conn}),
+	})
+}
+
+// Disconnect tells the lobby a player's connection has dropped. They keep
+// their place for the reconnect grace period, in case they resume.
+func (l *Lobby) Disconnect(conn *comms.ConnectionWrapper) {
+	l.Send(comms.Request{
+		PlayerID: conn.PlayerID,
+		Message:  comms.ToMessage(PlayerDisconnectedEvent{conn: conn}),
+	})
+}
+
+// UpdateProfile changes how a player is shown to the rest of the lobby.
+func (l *Lobby) UpdateProfile(conn *comms.ConnectionWrapper, profile Profile) {
+	l.Send(comms.Request{
+		PlayerID: conn.PlayerID,
+		Message:  comms.ToMessage(playerProfileUpdatedEvent{conn: conn, profile: profile}),
+	})
+}
+
+// Close closes the lobby, disconnecting everyone in it.
+func (l *Lobby) Close() {
+	l.Send(comms.Request{Message: comms.ToMessage(lobbyCloseEvent{})})
+}
+
+// Drain warns everyone in the lobby that the server is shutting down, and
+// closes the lobby once its running game ends. New games can't be started.
+func (l *Lobby) Drain(deadline time.Time) {
+	l.Send(comms.Request{
+		Message: comms.ToMessage(serverShuttingDownEvent{deadline: deadline}),
+	})
+}
+
+// Summary returns a snapshot of the lobby's state, as of the last request it
+// handled.
+func (l *Lobby) Summary() LobbySummary {
+	return l.summary.Load().(LobbySummary)
+}
+
+// Backlog returns the number of requests waiting to be handled.
+func (l *Lobby) Backlog() int {
+	return len(l.RequestChannel)
+}
+
+// Done returns a channel which is closed once the lobby has closed.
+func (l *Lobby) Done() <-chan struct{} {
+	return l.done
 }
 
-func (l *Lobby) broadcastMessageToPlayers(message comms.Message, players []string) {
-	for _, player := range players {
-		l.PlayerIDToConnStore[player].WriteChannel <- message
+// LobbyRequestHandler handles incoming requests and game timers until the
+// lobby closes.
+func (l *Lobby) LobbyRequestHandler(config *config.Config) {
+	lobbiesOpen.Inc()
+	defer func() {
+		lobbiesOpen.Dec()
+		lobbiesClosed.Inc()
+		close(l.done)
+	}()
+
+	for !l.closing {
+		select {
+		case req := <-l.RequestChannel:
+			start := time.Now()
+			l.handleRequest(config, req)
+			requestDuration.ObserveSince(start)
+
+		case id := <-l.timerChannel:
+			l.fireTimer(id)
+		}
+		l.updateSummary()
 	}
 }
 
-func (l *Lobby) getPlayersList() []string {
-	players := make([]string, len(l.PlayerIDToConnStore))
-	i := 0
-	for player := range l.PlayerIDToConnStore {
-		players[i] = player
-		i++
+func (l *Lobby) updateSummary() {
+	l.summary.Store(LobbySummary{
+		LobbyID:           l.LobbyID,
+		JoinCode:          l.JoinCode,
+		Name:              l.Settings.Name,
+		Public:            l.Settings.Public,
+		Game:              l.Settings.Game,
+		Players:           len(l.getPlayersList()),
+		Spectators:        len(l.getSpectatorsList()),
+		MaxPlayers:        l.Settings.MaxPlayers,
+		PasswordProtected: l.Settings.Password != "",
+		Locked:            l.Settings.Locked,
+		RunningGame:       l.GameName,
+		InProgress:        l.GameState != nil,
+	})
+}
+
+func (l *Lobby) handleRequest(config *config.Config, req comms.Request) {
+	// Events come from the server rather than clients, so are checked against
+	// their concrete types
+	switch event := req.Message.Contents.(type) {
+	case PlayerJoinedEvent:
+		l.playerJoined(req.PlayerID, event)
+		return
+	case PlayerDisconnectedEvent:
+		l.playerDisconnected(config, req.PlayerID, event.conn)
+		return
+	case PlayerLeftEvent:
+		l.playerLeft(req.PlayerID, event.conn)
+		return
+	case playerGracePeriodExpiredEvent:
+		l.playerGracePeriodExpired(req.PlayerID, event.conn)
+		return
+	case playerProfileUpdatedEvent:
+		l.updateProfile(req.PlayerID, event.conn, event.profile)
+		return
+	case lobbyCloseEvent:
+		l.close()
+		return
+	case serverShuttingDownEvent:
+		l.drain(event.deadline)
+		return
 	}
-	return players
-}
-
-// Reads in requests from games and sends them to players
-func (l *Lobby) GameRequestHandler() {
-	for {
-		req := <-l.GameRequestChan
-		l.broadcastMessageToPlayers(
-			comms.Message{
-				Type:     "Game/" + req.Message.Type,
-				Contents: req.Message.Contents,
-			},
-			req.Players,
-		)
+
+	switch req.Message.Type {
+	case "LobbyStartGameRequest":
+		// Host starts a Game
+		var contents LobbyStartGameRequest
+		err := mapstructure.Decode(req.Message.Contents, &contents)
+		if err != nil {
+			req.Error("Unable to parse LobbyStartGameRequest", err)
+			return
+		}
+
+		if contents.Game == "" {
+			contents.Game = l.Settings.Game
+		}
+		if req.PlayerID == l.Host {
+			if g, ok := config.Games[contents.Game]; ok {
+				l.startGameRequest(req, contents.Game, g, l.getPlayersList())
+			} else {
+				req.Error("Invalid game name", nil)
+			}
+		} else {
+			req.Error(fmt.Sprintf(
+				"Only the host can start a game (player %s, host %s)",
+				req.PlayerID,
+				l.Host,
+			), nil)
+		}
+
+	case "LobbyUpdateSettingsRequest":
+		// Host changes the lobby's settings
+		var contents LobbyUpdateSettingsRequest
+		err := mapstructure.Decode(req.Message.Contents, &contents)
+		if err != nil {
+			req.Error("Unable to parse LobbyUpdateSettingsRequest", err)
+			return
+		}
+
+		if req.PlayerID != l.Host {
+			req.Error(fmt.Sprintf(
+				"Only the host can change the lobby's settings (player %s, host %s)",
+				req.PlayerID,
+				l.Host,
+			), nil)
+		} else if err := l.updateSettings(config, contents); err != nil {
+			req.Error("Invalid lobby settings", err)
+		}
+
+	case "LobbyPlayerReadyRequest":
+		// Player says whether they're ready for the next game
+		var contents LobbyPlayerReadyRequest
+		err := mapstructure.Decode(req.Message.Contents, &contents)
+		if err != nil {
+			req.Error("Unable to parse LobbyPlayerReadyRequest", err)
+			return
+		}
+		l.setReady(req.PlayerID, contents.Ready)
+
+	case "LobbyChatMessageRequest":
+		// Player sends a chat message
+		var contents LobbyChatMessageRequest
+		err := mapstructure.Decode(req.Message.Contents, &contents)
+		if err != nil {
+			req.Error("Unable to parse LobbyChatMessageRequest", err)
+			return
+		}
+
+		if err := l.chat(req.PlayerID, contents); err != nil {
+			req.Error(err.Error(), nil)
+		}
+
+	case "LobbyKickPlayerRequest":
+		// Host removes a player from the lobby
+		var contents LobbyKickPlayerRequest
+		err := mapstructure.Decode(req.Message.Contents, &contents)
+		if err != nil {
+			req.Error("Unable to parse LobbyKickPlayerRequest", err)
+			return
+		}
+
+		if err := l.checkCanKick(req.PlayerID, contents.PlayerID); err != nil {
+			req.Error(err.Error(), nil)
+		} else {
+			l.kickPlayer(contents.PlayerID, contents.Reason, false)
+		}
+
+	case "LobbyBanPlayerRequest":
+		// Host removes a player from the lobby, stopping them from rejoining
+		var contents LobbyBanPlayerRequest
+		err := mapstructure.Decode(req.Message.Contents, &contents)
+		if err != nil {
+			req.Error("Unable to parse LobbyBanPlayerRequest", err)
+			return
+		}
+
+		if err := l.checkCanKick(req.PlayerID, contents.PlayerID); err != nil {
+			req.Error(err.Error(), nil)
+		} else {
+			l.kickPlayer(contents.PlayerID, contents.Reason, true)
+		}
+
+	case "LobbyTransferHostRequest":
+		// Host hands over to another player
+		var contents LobbyTransferHostRequest
+		err := mapstructure.Decode(req.Message.Contents, &contents)
+		if err != nil {
+			req.Error("Unable to parse LobbyTransferHostRequest", err)
+			return
+		}
+
+		if req.PlayerID != l.Host {
+			req.Error(fmt.Sprintf(
+				"Only the host can transfer host (player %s, host %s)",
+				req.PlayerID,
+				l.Host,
+			), nil)
+		} else if _, ok := l.players[contents.PlayerID]; !ok {
+			req.Error(fmt.Sprintf(
+				"Player %s is not in the lobby", contents.PlayerID), nil)
+		} else if contents.PlayerID != l.Host {
+			l.setHost(contents.PlayerID)
+		}
+
+	case "LobbyRematchRequest":
+		// Host restarts the last game with the same players
+		if req.PlayerID != l.Host {
+			req.Error(fmt.Sprintf(
+				"Only the host can start a rematch (player %s, host %s)",
+				req.PlayerID,
+				l.Host,
+			), nil)
+			return
+		}
+		if l.lastGameName == "" {
+			req.Error("No game has been played yet", nil)
+			return
+		}
+		for _, player := range l.lastGamePlayers {
+			if _, ok := l.players[player]; !ok {
+				req.Error(fmt.Sprintf(
+					"Player %s is no longer in the lobby", player), nil)
+				return
+			}
+			if l.isSpectator(player) {
+				req.Error(fmt.Sprintf("Player %s is now spectating", player), nil)
+				return
+			}
+		}
+		l.startGameRequest(
+			req, l.lastGameName, config.Games[l.lastGameName], l.lastGamePlayers)
+
+	default:
+		// Route non-lobby-related messages
+		typeComponents := strings.Split(req.Message.Type, "/")
+
+		switch typeComponents[0] {
+		case "Game":
+			if len(typeComponents) != 2 {
+				req.Error(fmt.Sprintf(
+					"%s is an invalid Game message type, it should be of the format "+
+						"'Game/<game-message-type>'",
+					req.Message.Type,
+				), nil)
+			} else if l.GameState == nil {
+				req.Error("Must set LobbyStartGameRequest first", nil)
+			} else if l.isSpectator(req.PlayerID) {
+				req.Error("Spectators can't send game messages", nil)
+			} else if !l.isInGame(req.PlayerID) || l.gameLeftPlayers[req.PlayerID] {
+				req.Error("Only players in the running game can send game messages", nil)
+			} else {
+				l.callGame(req.PlayerID, func() {
+					errMessage := l.GameState.HandleRequest(
+						l.GameContext, req.PlayerID,
+						typeComponents[1], req.Message.Contents)
+					if errMessage != nil {
+						req.Reply(errMessage)
+					}
+				})
+			}
+
+		default:
+			req.Error(
+				fmt.Sprintf("%s is an invalid message type", req.Message.Type), nil)
+		}
 	}
 }
 
-// LobbyStoreMap stores Lobby IDs mapped to Lobby structs
+// LobbyStoreMap stores Lobby IDs mapped to Lobby structs, indexed by join
+// code too
 type LobbyStore struct {
 	// We're using a sync.Map which is optimised for few writes but lots of reads
 	store sync.Map
+	// codes maps join codes to Lobby IDs
+	codes sync.Map
 }
 
-func (s *LobbyStore) Put(key string, value *Lobby) {
-	s.store.Store(key, value)
+// Put stores a lobby, allocating it a unique join code. It must be called
+// before the lobby's LobbyRequestHandler is running.
+func (s *LobbyStore) Put(key string, value *Lobby) error {
+	for i := 0; i < MAX_JOIN_CODE_ATTEMPTS; i++ {
+		code, err := newJoinCode()
+		if err != nil {
+			return err
+		}
+		if _, taken := s.codes.LoadOrStore(code, key); !taken {
+			value.JoinCode = code
+			// The summary was first taken before the lobby had a join code
+			value.updateSummary()
+			s.store.Store(key, value)
+			return nil
+		}
+	}
+	return ErrNoJoinCodes
 }
 
 func (s *LobbyStore) Get(key string) (*Lobby, bool) {
@@ -195,6 +523,71 @@ func (s *LobbyStore) Get(key string) (*Lobby, bool) {
 	return nil, false
 }
 
+// GetByJoinCode looks up a lobby by its join code, ignoring case.
+func (s *LobbyStore) GetByJoinCode(code string) (*Lobby, bool) {
+	key, ok := s.codes.Load(normaliseJoinCode(code))
+	if !ok {
+		return nil, false
+	}
+	return s.Get(key.(string))
+}
+
+// Delete removes a lobby, freeing its join code.
 func (s *LobbyStore) Delete(key string) {
+	if l, ok := s.Get(key); ok {
+		s.codes.Delete(l.JoinCode)
+	}
 	s.store.Delete(key)
 }
+
+// Range calls f for each lobby, stopping if f returns false
+func (s *LobbyStore) Range(f func(key string, value *Lobby) bool) {
+	s.store.Range(func(key, value interface{}) bool {
+		return f(key.(string), value.(*Lobby))
+	})
+}
+
+// PlayerStore maps client connections to the lobby players using them
+type PlayerStore struct {
+	lock  sync.RWMutex
+	store map[*comms.ConnectionWrapper]Player
+}
+
+func (s *PlayerStore) Put(key *comms.ConnectionWrapper, value Player) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.store == nil {
+		s.store = make(map[*comms.ConnectionWrapper]Player)
+	}
+	s.store[key] = value
+}
+
+func (s *PlayerStore) Get(key *comms.ConnectionWrapper) (Player, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	value, ok := s.store[key]
+	return value, ok
+}
+
+func (s *PlayerStore) Delete(key *comms.ConnectionWrapper) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.store, key)
+}
+
+// Range calls f for each connection, stopping if f returns false
+func (s *PlayerStore) Range(f func(key *comms.ConnectionWrapper, value Player) bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for key, value := range s.store {
+		if !f(key, value) {
+			return
+		}
+	}
+}
+
+func (s *PlayerStore) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.store)
+}
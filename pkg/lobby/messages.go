@@ -1,19 +1,222 @@
 package lobby
 
+import (
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+)
+
 // Lobby Player management
 type LobbyJoinRequest struct {
 	PlayerID string `json:"playerID"`
+	// Token is the session token given to the player by /createPlayer
+	Token string `json:"token"`
+	// Either the LobbyID or JoinCode of the lobby to join
 	LobbyID  string `json:"lobbyID"`
+	JoinCode string `json:"joinCode"`
+	// Password is needed to join lobbies which have one
+	Password string `json:"password"`
+	// Spectators watch the lobby's games without playing
+	Spectator bool `json:"spectator"`
+	// ResumeToken is needed to resume a session after disconnecting
+	ResumeToken string `json:"resumeToken"`
+}
+
+type LobbyJoinResponse struct {
+	LobbyID     string `json:"lobbyID"`
+	JoinCode    string `json:"joinCode"`
+	ResumeToken string `json:"resumeToken"`
+	Resumed     bool   `json:"resumed"`
+	Spectator   bool   `json:"spectator"`
 }
 
-type PlayerJoinedEvent struct{}
+type LobbyResumeFailedResponse struct {
+	Reason string `json:"reason"`
+}
+
+// InvalidSessionTokenResponse is sent when a player's session token is forged,
+// doesn't match their ID, or has expired, in which case they need to create a
+// new player
+type InvalidSessionTokenResponse struct {
+	Expired bool `json:"expired"`
+}
+
+type PlayerJoinedEvent struct {
+	conn        *comms.ConnectionWrapper
+	password    string
+	spectator   bool
+	profile     Profile
+	resumeToken string
+	joined      chan bool
+}
+
+// Responses turning away a player trying to join
+type LobbyFullResponse struct {
+	MaxPlayers int `json:"maxPlayers"`
+}
+
+type LobbyPasswordRequiredResponse struct {
+	// Incorrect is set if a password was given, but was wrong
+	Incorrect bool `json:"incorrect"`
+}
+
+type LobbyLockedResponse struct{}
+
+type LobbyGameInProgressResponse struct {
+	Game string `json:"game"`
+}
 
 type LobbyLeaveRequest struct{}
 
-type PlayerLeftEvent struct{}
+type PlayerLeftEvent struct {
+	conn *comms.ConnectionWrapper
+}
+
+type PlayerDisconnectedEvent struct {
+	conn *comms.ConnectionWrapper
+}
 
+type playerGracePeriodExpiredEvent struct {
+	conn *comms.ConnectionWrapper
+}
+
+type LobbyPlayerDisconnectedBroadcast struct {
+	PlayerID string     `json:"playerID"`
+	Player   PlayerInfo `json:"player"`
+	// Deadline is when the player will leave if they haven't reconnected
+	Deadline time.Time `json:"deadline"`
+}
+
+type LobbyPlayerReconnectedBroadcast struct {
+	PlayerID string     `json:"playerID"`
+	Player   PlayerInfo `json:"player"`
+}
+
+// LobbyPlayerListBroadcast lists everyone in the lobby, though PlayerIDs
+// leaves out spectators
 type LobbyPlayerListBroadcast struct {
-	PlayerIDs []string `json:"playerIDs"`
+	PlayerIDs []string     `json:"playerIDs"`
+	Players   []PlayerInfo `json:"players"`
+	HostID    string       `json:"hostID"`
+}
+
+const (
+	ROLE_PLAYER    = "player"
+	ROLE_SPECTATOR = "spectator"
+)
+
+// PlayerInfo describes a player in the lobby
+type PlayerInfo struct {
+	PlayerID  string `json:"playerID"`
+	Name      string `json:"name"`
+	Color     string `json:"color"`
+	Role      string `json:"role"`
+	Connected bool   `json:"connected"`
+	Ready     bool   `json:"ready"`
+}
+
+// Player profiles, where any field left out of the request is unchanged
+type PlayerUpdateProfileRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+type playerProfileUpdatedEvent struct {
+	conn    *comms.ConnectionWrapper
+	profile Profile
+}
+
+// Ready check, which can be required before the host starts a game
+type LobbyPlayerReadyRequest struct {
+	Ready bool `json:"ready"`
+}
+
+// Host management
+type LobbyTransferHostRequest struct {
+	PlayerID string `json:"playerID"`
+}
+
+type LobbyHostChangedBroadcast struct {
+	HostID string     `json:"hostID"`
+	Host   PlayerInfo `json:"host"`
+}
+
+// Moderation
+type LobbyKickPlayerRequest struct {
+	PlayerID string `json:"playerID"`
+	Reason   string `json:"reason"`
+}
+
+type LobbyBanPlayerRequest struct {
+	PlayerID string `json:"playerID"`
+	Reason   string `json:"reason"`
+}
+
+// KickedFromLobbyBroadcast is sent to a player who was kicked or banned, before
+// their connection is closed
+type KickedFromLobbyBroadcast struct {
+	Reason string `json:"reason"`
+	Banned bool   `json:"banned"`
+}
+
+type LobbyPlayerKickedBroadcast struct {
+	PlayerID string     `json:"playerID"`
+	Player   PlayerInfo `json:"player"`
+	Banned   bool       `json:"banned"`
+}
+
+type LobbyBannedResponse struct{}
+
+// Chat, sent to the whole lobby unless it's to the sender's team or whispered
+// to another player
+type LobbyChatMessageRequest struct {
+	Text string `json:"text"`
+	Team bool   `json:"team"`
+	To   string `json:"to"`
+}
+
+type LobbyChatBroadcast struct {
+	SenderID  string     `json:"senderID"`
+	Sender    PlayerInfo `json:"sender"`
+	Text      string     `json:"text"`
+	Timestamp time.Time  `json:"timestamp"`
+	// Team is set if the message was sent to that team
+	Team string `json:"team,omitempty"`
+	// To is set if the message was whispered to that player
+	To string `json:"to,omitempty"`
+}
+
+// LobbyChatHistoryResponse is sent to players joining the lobby, with the
+// latest messages sent to the whole lobby
+type LobbyChatHistoryResponse struct {
+	Messages []LobbyChatBroadcast `json:"messages"`
+}
+
+// Lobby settings, where any field left out of the request is unchanged
+type LobbyUpdateSettingsRequest struct {
+	Name             *string `json:"name"`
+	Public           *bool   `json:"public"`
+	Game             *string `json:"game"`
+	MaxPlayers       *int    `json:"maxPlayers"`
+	Password         *string `json:"password"`
+	Locked           *bool   `json:"locked"`
+	AllowJoinMidGame *bool   `json:"allowJoinMidGame"`
+	RequireReady     *bool   `json:"requireReady"`
+}
+
+type LobbySettingsBroadcast struct {
+	Settings          LobbySettings `json:"settings"`
+	PasswordProtected bool          `json:"passwordProtected"`
+}
+
+// Lobby browser
+type LobbyListSubscribeRequest struct{}
+
+type LobbyListUnsubscribeRequest struct{}
+
+type LobbyListBroadcast struct {
+	Lobbies []LobbySummary `json:"lobbies"`
 }
 
 // Starting a Game
@@ -28,6 +231,45 @@ type LobbyStartGameResponse struct {
 
 type LobbyStartGameBroadcast struct {
 	Game string `json:"game"`
+	// Players are the game's players
+	Players []PlayerInfo `json:"players"`
+}
+
+// Ending a Game
+type LobbyGameEndedBroadcast struct {
+	Game   string      `json:"game"`
+	Result game.Result `json:"result"`
+}
+
+type LobbyRematchRequest struct{}
+
+type GameAbortedBroadcast struct {
+	Game   string `json:"game"`
+	Reason string `json:"reason"`
+}
+
+type LobbyPlayerLeftGameBroadcast struct {
+	PlayerID string     `json:"playerID"`
+	Player   PlayerInfo `json:"player"`
+	Game     string     `json:"game"`
+}
+
+type LobbyPlayerRejoinedGameBroadcast struct {
+	PlayerID string     `json:"playerID"`
+	Player   PlayerInfo `json:"player"`
+	Game     string     `json:"game"`
+}
+
+type lobbyCloseEvent struct{}
+
+// Server shutting down, after which the lobby closes once its game has ended
+type serverShuttingDownEvent struct {
+	deadline time.Time
+}
+
+type ServerShuttingDownBroadcast struct {
+	// Deadline is when the lobby will be closed, even if its game is running
+	Deadline time.Time `json:"deadline"`
 }
 
 type LobbyClosedBroadcast struct{}
@@ -0,0 +1,26 @@
+package lobby
+
+import "github.com/JJ-Intelligence/SR-Games-Backend/pkg/metrics"
+
+var (
+	lobbiesCreated = metrics.NewCounter(
+		"srgames_lobbies_created_total", "Number of lobbies created.")
+	lobbiesClosed = metrics.NewCounter(
+		"srgames_lobbies_closed_total", "Number of lobbies closed.")
+	lobbiesOpen = metrics.NewGauge(
+		"srgames_lobbies_open", "Number of lobbies currently open.")
+
+	playersJoined = metrics.NewCounter(
+		"srgames_players_joined_total", "Number of players who joined a lobby.")
+	playersLeft = metrics.NewCounter(
+		"srgames_players_left_total", "Number of players who left a lobby.")
+
+	gameStarts = metrics.NewCounterVec(
+		"srgames_game_starts_total", "Number of games started, by game.", "game")
+
+	requestDuration = metrics.NewHistogram(
+		"srgames_lobby_request_duration_seconds",
+		"Time taken for a lobby to handle a request.",
+		metrics.LATENCY_BUCKETS,
+	)
+)
@@ -0,0 +1,497 @@
+package lobby
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/ratelimit"
+)
+
+const MAX_MISSED_MESSAGES = 100
+
+// lobbyPlayer is a player in a lobby
+type lobbyPlayer struct {
+	// conn is the player's latest connection, which is kept after they
+	// disconnect to tell it apart from any connection they resume with
+	conn      *comms.ConnectionWrapper
+	connected bool
+
+	// resumeToken must be given to resume the player's session
+	resumeToken string
+
+	// joinOrder orders players by when they joined, for host migration
+	joinOrder int
+
+	// missedMessages stores messages sent while the player was disconnected,
+	// which are sent on once they resume
+	missedMessages []comms.Message
+	graceTimer     *time.Timer
+
+	chatLimiter *ratelimit.Bucket
+
+	// ready is set when the player is ready for the next game to start
+	ready bool
+
+	// spectators watch games without playing in them
+	spectator bool
+
+	profile Profile
+}
+
+// newResumeToken generates a random token for a player to resume their session
+func newResumeToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// playerJoined adds a player's connection to the lobby, or resumes their
+// session if they're already in it
+func (l *Lobby) playerJoined(playerID string, event PlayerJoinedEvent) {
+	if p, ok := l.players[playerID]; ok {
+		if subtle.ConstantTimeCompare(
+			[]byte(event.resumeToken), []byte(p.resumeToken)) != 1 {
+			event.conn.SendOrClose(comms.ToMessage(LobbyResumeFailedResponse{
+				Reason: "Player is already in the lobby, and the resume token is invalid",
+			}))
+			event.joined <- false
+			return
+		}
+
+		l.resumePlayer(playerID, p, event.conn)
+		event.joined <- true
+		return
+	}
+
+	if response := l.admit(playerID, event.password, event.spectator); response != nil {
+		event.conn.SendOrClose(comms.ToMessage(response))
+		event.joined <- false
+		return
+	}
+
+	token, err := newResumeToken()
+	if err != nil {
+		event.conn.SendOrClose(comms.ToMessage(comms.ErrorResponse{
+			Reason: "Unable to create resume token",
+			Error:  err,
+		}))
+		event.joined <- false
+		return
+	}
+
+	l.nextJoinOrder++
+	l.players[playerID] = &lobbyPlayer{
+		conn:        event.conn,
+		connected:   true,
+		resumeToken: token,
+		joinOrder:   l.nextJoinOrder,
+		chatLimiter: newChatLimiter(),
+		spectator:   event.spectator,
+		profile:     event.profile,
+	}
+	event.joined <- true
+	playersJoined.Inc()
+	l.Log.Info(fmt.Sprintf("Player %s joined Lobby %s", playerID, l.LobbyID))
+
+	l.sendToPlayer(playerID, LobbyJoinResponse{
+		LobbyID:     l.LobbyID,
+		JoinCode:    l.JoinCode,
+		ResumeToken: token,
+		Spectator:   event.spectator,
+	})
+	l.sendToPlayer(playerID, l.settingsBroadcast())
+	l.sendToPlayer(playerID, l.chatHistoryResponse())
+	l.broadcastPlayerList()
+	if l.GameState != nil {
+		// Spectators and players joining mid-game need to know it's running
+		l.sendToPlayer(playerID, l.startGameBroadcast())
+	}
+	l.playerRejoinedGame(playerID)
+}
+
+// resumePlayer reattaches a player to the lobby on a new connection, sending
+// them everything they missed
+func (l *Lobby) resumePlayer(playerID string, p *lobbyPlayer, conn *comms.ConnectionWrapper) {
+	wasConnected := p.connected
+	if wasConnected {
+		// The old connection hasn't been noticed dying yet
+		p.conn.Close()
+	}
+	if p.graceTimer != nil {
+		p.graceTimer.Stop()
+		p.graceTimer = nil
+	}
+	p.conn = conn
+	p.connected = true
+	l.Log.Info(fmt.Sprintf("Player %s resumed in Lobby %s", playerID, l.LobbyID))
+
+	l.sendToPlayer(playerID, LobbyJoinResponse{
+		LobbyID:     l.LobbyID,
+		JoinCode:    l.JoinCode,
+		ResumeToken: p.resumeToken,
+		Resumed:     true,
+		Spectator:   p.spectator,
+	})
+	missed := p.missedMessages
+	p.missedMessages = nil
+	for _, message := range missed {
+		l.sendMessageToPlayer(p, message)
+	}
+
+	l.sendToPlayer(playerID, l.settingsBroadcast())
+	l.sendToPlayer(playerID, l.playerListBroadcast())
+	if l.isInGame(playerID) {
+		l.sendToPlayer(playerID, l.startGameBroadcast())
+	}
+	if !wasConnected {
+		l.broadcastMessageToLobbyExcept(LobbyPlayerReconnectedBroadcast{
+			PlayerID: playerID,
+			Player:   l.playerInfo(playerID),
+		}, playerID)
+	}
+}
+
+// playerDisconnected holds a disconnected player's place in the lobby for the
+// reconnect grace period, after which they leave
+func (l *Lobby) playerDisconnected(
+	config *config.Config,
+	playerID string,
+	conn *comms.ConnectionWrapper,
+) {
+	p, ok := l.players[playerID]
+	if !ok || p.conn != conn || !p.connected {
+		// This connection has already been replaced
+		return
+	}
+
+	gracePeriod := config.ReconnectGracePeriod
+	if gracePeriod <= 0 {
+		l.removePlayer(playerID)
+		return
+	}
+
+	p.connected = false
+	p.graceTimer = time.AfterFunc(gracePeriod, func() {
+		l.Send(comms.Request{
+			PlayerID: playerID,
+			Message:  comms.ToMessage(playerGracePeriodExpiredEvent{conn: conn}),
+		})
+	})
+	l.Log.Info(fmt.Sprintf(
+		"Player %s disconnected from Lobby %s", playerID, l.LobbyID))
+
+	l.broadcastMessageToLobbyExcept(LobbyPlayerDisconnectedBroadcast{
+		PlayerID: playerID,
+		Player:   l.playerInfo(playerID),
+		Deadline: time.Now().Add(gracePeriod),
+	}, playerID)
+}
+
+// playerGracePeriodExpired removes a player who didn't reconnect in time
+func (l *Lobby) playerGracePeriodExpired(playerID string, conn *comms.ConnectionWrapper) {
+	if p, ok := l.players[playerID]; ok && p.conn == conn && !p.connected {
+		l.removePlayer(playerID)
+	}
+}
+
+// playerLeft removes a player who asked to leave the lobby
+func (l *Lobby) playerLeft(playerID string, conn *comms.ConnectionWrapper) {
+	if p, ok := l.players[playerID]; ok && p.conn == conn {
+		l.removePlayer(playerID)
+	}
+}
+
+func (l *Lobby) removePlayer(playerID string) {
+	p := l.players[playerID]
+	if p.graceTimer != nil {
+		p.graceTimer.Stop()
+	}
+	info := l.playerInfo(playerID)
+	info.Connected = false
+	delete(l.players, playerID)
+	playersLeft.Inc()
+	l.Log.Info(fmt.Sprintf("Player %s left lobby %s", playerID, l.LobbyID))
+
+	// Close the lobby once everyone has left
+	if len(l.players) == 0 {
+		l.close()
+		return
+	}
+
+	if playerID == l.Host {
+		l.setHost(l.longestConnectedPlayer())
+	}
+	l.broadcastPlayerList()
+	l.playerLeftGame(info)
+}
+
+// checkCanKick returns an error if the player can't kick the target
+func (l *Lobby) checkCanKick(playerID, targetID string) error {
+	if playerID != l.Host {
+		return fmt.Errorf(
+			"Only the host can kick players (player %s, host %s)", playerID, l.Host)
+	}
+	if targetID == playerID {
+		return errors.New("The host can't kick themselves")
+	}
+	if _, ok := l.players[targetID]; !ok {
+		return fmt.Errorf("Player %s is not in the lobby", targetID)
+	}
+	return nil
+}
+
+// kickPlayer removes a player from the lobby, closing their connection, and
+// stops them from rejoining if they're banned
+func (l *Lobby) kickPlayer(playerID, reason string, ban bool) {
+	if ban {
+		l.banned[playerID] = true
+	}
+	l.Log.Info(fmt.Sprintf(
+		"Player %s was kicked from lobby %s (banned %t)", playerID, l.LobbyID, ban))
+
+	// The connection is closed once this has been written to it
+	l.sendToPlayer(playerID, KickedFromLobbyBroadcast{
+		Reason: reason,
+		Banned: ban,
+	})
+	l.broadcastMessageToLobbyExcept(LobbyPlayerKickedBroadcast{
+		PlayerID: playerID,
+		Player:   l.playerInfo(playerID),
+		Banned:   ban,
+	}, playerID)
+	l.removePlayer(playerID)
+}
+
+// setHost makes another player the host
+func (l *Lobby) setHost(playerID string) {
+	l.Host = playerID
+	l.Log.Info(fmt.Sprintf("Player %s is now host of lobby %s", playerID, l.LobbyID))
+	l.broadcastMessageToLobby(LobbyHostChangedBroadcast{
+		HostID: playerID,
+		Host:   l.playerInfo(playerID),
+	})
+}
+
+// longestConnectedPlayer picks the player who joined the lobby first,
+// preferring players who are still connected, and only picking a spectator if
+// there are no players left
+func (l *Lobby) longestConnectedPlayer() string {
+	var (
+		chosenID string
+		chosen   *lobbyPlayer
+	)
+	for id, p := range l.players {
+		if chosen == nil ||
+			(!p.spectator && chosen.spectator) ||
+			(p.spectator == chosen.spectator && p.connected && !chosen.connected) ||
+			(p.spectator == chosen.spectator && p.connected == chosen.connected &&
+				p.joinOrder < chosen.joinOrder) {
+			chosenID = id
+			chosen = p
+		}
+	}
+	return chosenID
+}
+
+// close closes the lobby, once the current request has been handled
+func (l *Lobby) close() {
+	if l.closing {
+		return
+	}
+	l.Log.Info(fmt.Sprintf("Closing lobby %s", l.LobbyID))
+
+	l.broadcastMessageToLobby(LobbyClosedBroadcast{})
+	l.endGame()
+	for _, p := range l.players {
+		if p.graceTimer != nil {
+			p.graceTimer.Stop()
+		}
+	}
+	l.closing = true
+}
+
+// drain tells players the server is shutting down, closing the lobby now if
+// there's no game running, otherwise once the game ends
+func (l *Lobby) drain(deadline time.Time) {
+	l.Log.Info(fmt.Sprintf("Draining lobby %s", l.LobbyID))
+	l.draining = true
+	l.broadcastMessageToLobby(ServerShuttingDownBroadcast{Deadline: deadline})
+	if l.GameState == nil {
+		l.close()
+	}
+}
+
+func (l *Lobby) playerListBroadcast() LobbyPlayerListBroadcast {
+	everyone := make([]string, 0, len(l.players))
+	for playerID := range l.players {
+		everyone = append(everyone, playerID)
+	}
+	sort.Strings(everyone)
+
+	players := []string{}
+	info := make([]PlayerInfo, len(everyone))
+	for i, playerID := range everyone {
+		if !l.players[playerID].spectator {
+			players = append(players, playerID)
+		}
+		info[i] = l.playerInfo(playerID)
+	}
+	return LobbyPlayerListBroadcast{
+		PlayerIDs: players,
+		Players:   info,
+		HostID:    l.Host,
+	}
+}
+
+// playerInfo describes a player to the rest of the lobby. Players who have
+// left are described by just their ID.
+func (l *Lobby) playerInfo(playerID string) PlayerInfo {
+	p, ok := l.players[playerID]
+	if !ok {
+		return PlayerInfo{PlayerID: playerID, Role: ROLE_PLAYER}
+	}
+	role := ROLE_PLAYER
+	if p.spectator {
+		role = ROLE_SPECTATOR
+	}
+	return PlayerInfo{
+		PlayerID:  playerID,
+		Name:      p.profile.Name,
+		Color:     p.profile.Color,
+		Role:      role,
+		Connected: p.connected,
+		Ready:     p.ready,
+	}
+}
+
+// updateProfile changes how a player is shown to the rest of the lobby
+func (l *Lobby) updateProfile(playerID string, conn *comms.ConnectionWrapper, profile Profile) {
+	if p, ok := l.players[playerID]; ok && p.conn == conn {
+		p.profile = profile
+		l.broadcastPlayerList()
+	}
+}
+
+// setReady sets whether a player is ready for the next game to start
+func (l *Lobby) setReady(playerID string, ready bool) {
+	if p, ok := l.players[playerID]; ok && p.ready != ready {
+		p.ready = ready
+		l.broadcastPlayerList()
+	}
+}
+
+// resetReady marks every player as not ready, once a game has started
+func (l *Lobby) resetReady() {
+	for _, p := range l.players {
+		p.ready = false
+	}
+	l.broadcastPlayerList()
+}
+
+// notReadyPlayers returns the sorted IDs of the given players who aren't ready
+func (l *Lobby) notReadyPlayers(players []string) []string {
+	var notReady []string
+	for _, playerID := range players {
+		if p, ok := l.players[playerID]; !ok || !p.ready {
+			notReady = append(notReady, playerID)
+		}
+	}
+	sort.Strings(notReady)
+	return notReady
+}
+
+func (l *Lobby) broadcastPlayerList() {
+	l.broadcastMessageToLobby(l.playerListBroadcast())
+}
+
+// sendToPlayer sends a message to a player, holding onto it if they're
+// disconnected so they receive it when they resume
+func (l *Lobby) sendToPlayer(playerID string, contents interface{}) {
+	if p, ok := l.players[playerID]; ok {
+		l.sendMessageToPlayer(p, comms.ToMessage(contents))
+	}
+}
+
+// sendMessageToPlayer queues a message for a player without blocking the
+// lobby. Players who aren't keeping up are disconnected, and are sent the
+// messages they missed if they resume their session.
+func (l *Lobby) sendMessageToPlayer(p *lobbyPlayer, message comms.Message) {
+	if p.connected {
+		select {
+		case <-p.conn.Closed():
+			// The lobby hasn't been told the player disconnected yet
+		default:
+			if p.conn.SendOrClose(message) {
+				return
+			}
+			l.Log.Info(fmt.Sprintf(
+				"Player %s in Lobby %s isn't keeping up with messages, disconnecting them",
+				p.conn.PlayerID, l.LobbyID))
+		}
+	}
+
+	p.missedMessages = append(p.missedMessages, message)
+	if len(p.missedMessages) > MAX_MISSED_MESSAGES {
+		p.missedMessages = p.missedMessages[1:]
+	}
+}
+
+func (l *Lobby) broadcastMessageToLobby(contents interface{}) {
+	message := comms.ToMessage(contents)
+	for _, p := range l.players {
+		l.sendMessageToPlayer(p, message)
+	}
+}
+
+// broadcastMessageToLobbyExcept broadcasts to everyone but the given player
+func (l *Lobby) broadcastMessageToLobbyExcept(contents interface{}, playerID string) {
+	message := comms.ToMessage(contents)
+	for id, p := range l.players {
+		if id != playerID {
+			l.sendMessageToPlayer(p, message)
+		}
+	}
+}
+
+func (l *Lobby) broadcastMessageToPlayers(message comms.Message, players []string) {
+	for _, player := range players {
+		if p, ok := l.players[player]; ok {
+			l.sendMessageToPlayer(p, message)
+		}
+	}
+}
+
+// getPlayersList returns the IDs of everyone in the lobby but spectators
+func (l *Lobby) getPlayersList() []string {
+	players := []string{}
+	for player, p := range l.players {
+		if !p.spectator {
+			players = append(players, player)
+		}
+	}
+	return players
+}
+
+func (l *Lobby) getSpectatorsList() []string {
+	spectators := []string{}
+	for player, p := range l.players {
+		if p.spectator {
+			spectators = append(spectators, player)
+		}
+	}
+	return spectators
+}
+
+func (l *Lobby) isSpectator(playerID string) bool {
+	p, ok := l.players[playerID]
+	return ok && p.spectator
+}
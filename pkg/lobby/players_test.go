@@ -0,0 +1,136 @@
+package lobby
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// TestSlowPlayerDoesntBlockLobby checks a player whose messages are never
+// written doesn't stop the lobby from handling requests, and is sent what
+// they missed when they resume.
+func TestSlowPlayerDoesntBlockLobby(t *testing.T) {
+	host, slow, late := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	l := newTestLobby(t, host, nil)
+	joinTestLobby(t, l, host, newTestConn(t, 100))
+
+	// Joining fills the slow player's queue with the join response, settings,
+	// chat history and player list
+	slowConn := newTestConn(t, 4)
+	joinTestLobby(t, l, slow, slowConn)
+	if len(slowConn.WriteChannel) != cap(slowConn.WriteChannel) {
+		t.Fatalf("Slow player was sent %d messages on joining", len(slowConn.WriteChannel))
+	}
+
+	joinTestLobby(t, l, late, newTestConn(t, 100))
+	select {
+	case <-slowConn.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("Slow player wasn't disconnected")
+	}
+	var joined LobbyJoinResponse
+	expectMessage(t, slowConn, &joined)
+
+	resumed := newTestConn(t, 100)
+	if err := l.Join(resumed, LobbyJoinRequest{
+		PlayerID:    slow,
+		LobbyID:     l.LobbyID,
+		ResumeToken: joined.ResumeToken,
+	}, Profile{}); err != nil {
+		t.Fatal(err)
+	}
+	var resumeResponse LobbyJoinResponse
+	expectMessage(t, resumed, &resumeResponse)
+	if !resumeResponse.Resumed {
+		t.Error("Slow player's session wasn't resumed")
+	}
+
+	// The player list sent when the late player joined was missed
+	var players LobbyPlayerListBroadcast
+	expectMessage(t, resumed, &players)
+	if len(players.Players) != 3 {
+		t.Errorf("Missed player list has %d players, want 3", len(players.Players))
+	}
+}
+
+// newTestLobby runs a lobby which can play the given games
+func newTestLobby(t *testing.T, host string, games map[string]game.Game) *Lobby {
+	l := NewLobby(zap.NewNop(), uuid.NewString(), host, DefaultLobbySettings(), 10)
+	go l.LobbyRequestHandler(&config.Config{
+		Games:                games,
+		ReconnectGracePeriod: time.Minute,
+	})
+	t.Cleanup(l.Close)
+	return l
+}
+
+// sendTestRequest sends a message to the lobby from a player
+func sendTestRequest(
+	l *Lobby,
+	playerID string,
+	conn *comms.ConnectionWrapper,
+	messageType string,
+	contents map[string]interface{},
+) {
+	l.Send(comms.Request{
+		Conn:     conn,
+		PlayerID: playerID,
+		Message:  comms.Message{Type: messageType, Contents: contents},
+	})
+}
+
+func joinTestLobby(t *testing.T, l *Lobby, playerID string, conn *comms.ConnectionWrapper) {
+	conn.PlayerID = playerID
+	if err := l.Join(conn, LobbyJoinRequest{PlayerID: playerID, LobbyID: l.LobbyID}, Profile{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestConn creates a connection whose queued messages are never written,
+// so tests can read them from its WriteChannel
+func newTestConn(t *testing.T, bufferLen int) *comms.ConnectionWrapper {
+	upgrader := websocket.Upgrader{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ws, err := upgrader.Upgrade(w, r, nil); err == nil {
+			t.Cleanup(func() { ws.Close() })
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := comms.NewConnectionWrapper(ws, bufferLen, comms.ConnectionLimits{})
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+// expectMessage reads queued messages until one has the type contents points
+// to, which it's stored in
+func expectMessage(t *testing.T, conn *comms.ConnectionWrapper, contents interface{}) {
+	value := reflect.ValueOf(contents).Elem()
+	want := value.Type().Name()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case message := <-conn.WriteChannel:
+			if message.Type == want {
+				value.Set(reflect.ValueOf(message.Contents))
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s", want)
+		}
+	}
+}
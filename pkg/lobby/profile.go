@@ -0,0 +1,102 @@
+package lobby
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MAX_PLAYER_NAME_LEN = 20
+
+	// PROFILE_TTL is how long a ProfileStore keeps a profile which hasn't been
+	// used
+	PROFILE_TTL = 24 * time.Hour
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Profile is how a player is shown to the other players in a lobby
+type Profile struct {
+	Name string `json:"name"`
+	// Color is a hex color like "#ff8800"
+	Color string `json:"color"`
+}
+
+// Validate checks the profile is allowed. Both fields are optional.
+func (p Profile) Validate() error {
+	if utf8.RuneCountInString(p.Name) > MAX_PLAYER_NAME_LEN {
+		return fmt.Errorf(
+			"player name must be at most %d characters", MAX_PLAYER_NAME_LEN)
+	}
+	for _, r := range p.Name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("player name can't contain control characters")
+		}
+	}
+	if p.Color != "" && !colorPattern.MatchString(p.Color) {
+		return fmt.Errorf("invalid color %s, which should be like #ff8800", p.Color)
+	}
+	return nil
+}
+
+// Update applies the fields given in a PlayerUpdateProfileRequest, returning
+// the new profile
+func (p Profile) Update(update PlayerUpdateProfileRequest) (Profile, error) {
+	if update.Name != nil {
+		p.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Color != nil {
+		p.Color = *update.Color
+	}
+	return p, p.Validate()
+}
+
+// ProfileStore stores players' profiles by player ID, forgetting them once
+// they haven't been used for the PROFILE_TTL
+type ProfileStore struct {
+	lock  sync.Mutex
+	store map[string]*storedProfile
+}
+
+type storedProfile struct {
+	profile  Profile
+	lastUsed time.Time
+}
+
+func (s *ProfileStore) Put(playerID string, profile Profile) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.store == nil {
+		s.store = make(map[string]*storedProfile)
+	}
+	s.store[playerID] = &storedProfile{profile: profile, lastUsed: time.Now()}
+}
+
+// Get returns the player's profile, or an empty profile if they haven't got one
+func (s *ProfileStore) Get(playerID string) Profile {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stored, ok := s.store[playerID]
+	if !ok {
+		return Profile{}
+	}
+	stored.lastUsed = time.Now()
+	return stored.profile
+}
+
+// Expire removes profiles which haven't been used for the PROFILE_TTL
+func (s *ProfileStore) Expire() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	cutoff := time.Now().Add(-PROFILE_TTL)
+	for playerID, stored := range s.store {
+		if stored.lastUsed.Before(cutoff) {
+			delete(s.store, playerID)
+		}
+	}
+}
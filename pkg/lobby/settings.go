@@ -0,0 +1,130 @@
+package lobby
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
+)
+
+const MAX_LOBBY_NAME_LEN = 50
+
+// LobbySettings are chosen by the host when creating a lobby, and can be
+// changed with a LobbyUpdateSettingsRequest
+type LobbySettings struct {
+	Name string `json:"name"`
+	// Public lobbies are listed in the lobby browser
+	Public bool `json:"public"`
+	// Game is started when the host doesn't name a game to start
+	Game string `json:"game"`
+
+	// MaxPlayers limits the number of players, unless it's 0
+	MaxPlayers int `json:"maxPlayers"`
+	// Password must be given to join, unless it's empty
+	Password string `json:"-"`
+	// Locked lobbies can't be joined
+	Locked bool `json:"locked"`
+	// AllowJoinMidGame lets players join while a game is running
+	AllowJoinMidGame bool `json:"allowJoinMidGame"`
+	// RequireReady stops the host starting a game until everyone is ready
+	RequireReady bool `json:"requireReady"`
+}
+
+// DefaultLobbySettings are the settings a lobby is created with, unless the
+// host chooses otherwise
+func DefaultLobbySettings() LobbySettings {
+	return LobbySettings{AllowJoinMidGame: true}
+}
+
+// Validate checks the settings are allowed, given the games in the config.
+func (s LobbySettings) Validate(config *config.Config) error {
+	if utf8.RuneCountInString(s.Name) > MAX_LOBBY_NAME_LEN {
+		return fmt.Errorf(
+			"lobby name must be at most %d characters", MAX_LOBBY_NAME_LEN)
+	}
+	if s.Game != "" {
+		if _, ok := config.Games[s.Game]; !ok {
+			return fmt.Errorf("invalid game name %s", s.Game)
+		}
+	}
+	if s.MaxPlayers < 0 {
+		return fmt.Errorf("max players can't be negative")
+	}
+	return nil
+}
+
+// updateSettings applies the settings given in a LobbyUpdateSettingsRequest,
+// telling everyone in the lobby
+func (l *Lobby) updateSettings(config *config.Config, update LobbyUpdateSettingsRequest) error {
+	settings := l.Settings
+	if update.Name != nil {
+		settings.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Public != nil {
+		settings.Public = *update.Public
+	}
+	if update.Game != nil {
+		settings.Game = *update.Game
+	}
+	if update.MaxPlayers != nil {
+		settings.MaxPlayers = *update.MaxPlayers
+	}
+	if update.Password != nil {
+		settings.Password = *update.Password
+	}
+	if update.Locked != nil {
+		settings.Locked = *update.Locked
+	}
+	if update.AllowJoinMidGame != nil {
+		settings.AllowJoinMidGame = *update.AllowJoinMidGame
+	}
+	if update.RequireReady != nil {
+		settings.RequireReady = *update.RequireReady
+	}
+
+	if err := settings.Validate(config); err != nil {
+		return err
+	}
+	l.Settings = settings
+	l.broadcastMessageToLobby(l.settingsBroadcast())
+	return nil
+}
+
+func (l *Lobby) settingsBroadcast() LobbySettingsBroadcast {
+	return LobbySettingsBroadcast{
+		Settings:          l.Settings,
+		PasswordProtected: l.Settings.Password != "",
+	}
+}
+
+// admit checks whether a new player can join the lobby, returning the
+// response turning them away if not. The host is always let in, and
+// spectators can join full lobbies and running games.
+func (l *Lobby) admit(playerID, password string, spectator bool) interface{} {
+	if playerID == l.Host {
+		return nil
+	}
+
+	if l.banned[playerID] {
+		return LobbyBannedResponse{}
+	}
+	if l.Settings.Locked {
+		return LobbyLockedResponse{}
+	}
+	if l.Settings.Password != "" && subtle.ConstantTimeCompare(
+		[]byte(password), []byte(l.Settings.Password)) != 1 {
+		return LobbyPasswordRequiredResponse{Incorrect: password != ""}
+	}
+	if spectator {
+		return nil
+	}
+	if max := l.Settings.MaxPlayers; max > 0 && len(l.getPlayersList()) >= max {
+		return LobbyFullResponse{MaxPlayers: max}
+	}
+	if l.GameState != nil && !l.Settings.AllowJoinMidGame {
+		return LobbyGameInProgressResponse{Game: l.GameName}
+	}
+	return nil
+}
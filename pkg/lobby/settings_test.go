@@ -0,0 +1,34 @@
+package lobby
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+)
+
+func TestValidateSettings(t *testing.T) {
+	cfg := &config.Config{Games: map[string]game.Game{"test": newTestGame()}}
+	tests := []struct {
+		name     string
+		settings LobbySettings
+		valid    bool
+	}{
+		{"default", DefaultLobbySettings(), true},
+		{"longest name", LobbySettings{Name: strings.Repeat("a", MAX_LOBBY_NAME_LEN)}, true},
+		{"name too long", LobbySettings{Name: strings.Repeat("a", MAX_LOBBY_NAME_LEN+1)}, false},
+		{"longest accented name", LobbySettings{Name: strings.Repeat("é", MAX_LOBBY_NAME_LEN)}, true},
+		{"longest emoji name", LobbySettings{Name: strings.Repeat("🎲", MAX_LOBBY_NAME_LEN)}, true},
+		{"emoji name too long", LobbySettings{Name: strings.Repeat("🎲", MAX_LOBBY_NAME_LEN+1)}, false},
+		{"game", LobbySettings{Game: "test"}, true},
+		{"invalid game", LobbySettings{Game: "chess"}, false},
+		{"max players", LobbySettings{MaxPlayers: 4}, true},
+		{"negative max players", LobbySettings{MaxPlayers: -1}, false},
+	}
+	for _, test := range tests {
+		if err := test.settings.Validate(cfg); (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LATENCY_BUCKETS are histogram buckets, in seconds, for timing operations
+// which should take well under a second
+var LATENCY_BUCKETS = []float64{
+	0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.5, 1,
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	lock sync.Mutex
+	// counts holds the number of observations in each bucket, which aren't
+	// cumulative until written
+	counts  []uint64
+	sum     float64
+	count   uint64
+	buckets []float64
+	name    string
+	help    string
+}
+
+// NewHistogram creates a histogram in the DefaultRegistry, with buckets given
+// by their upper bounds.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{
+		counts:  make([]uint64, len(buckets)),
+		buckets: buckets,
+		name:    name,
+		help:    help,
+	}
+	DefaultRegistry.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.buckets, value)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += value
+	h.count++
+}
+
+// ObserveSince observes the seconds elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) describe() (string, string, string) {
+	return h.name, h.help, "histogram"
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.lock.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.lock.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, count)
+}
@@ -0,0 +1,164 @@
+// Package metrics implements counters, gauges and histograms which are
+// exposed in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// metric is a metric which can be written in the Prometheus text format
+type metric interface {
+	describe() (name, help, kind string)
+	write(w io.Writer)
+}
+
+// Registry holds metrics, writing them in the order they were registered
+type Registry struct {
+	lock    sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// DefaultRegistry holds the metrics created with NewCounter, NewGauge,
+// NewCounterVec and NewHistogram.
+var DefaultRegistry = NewRegistry()
+
+// register adds a metric to the registry, panicking if its name has already
+// been taken.
+func (r *Registry) register(m metric) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	name, _, _ := m.describe()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: metric %s registered twice", name))
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every metric in the registry in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.lock.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.lock.Unlock()
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		name, help, kind := m.describe()
+		fmt.Fprintf(&buf, "# HELP %s %s\n", name, escapeHelp(help))
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, kind)
+		m.write(&buf)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Handler serves the registry's metrics to Prometheus.
+func (r *Registry) Handler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		r.Write(w)
+	}
+}
+
+// Counter is a value which only goes up
+type Counter struct {
+	value uint64
+	name  string
+	help  string
+}
+
+// NewCounter creates a counter in the DefaultRegistry.
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	DefaultRegistry.register(c)
+	return c
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+func (c *Counter) describe() (string, string, string) {
+	return c.name, c.help, "counter"
+}
+
+func (c *Counter) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+}
+
+// Gauge is a value which can go up and down
+type Gauge struct {
+	value int64
+	name  string
+	help  string
+}
+
+// NewGauge creates a gauge in the DefaultRegistry.
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	DefaultRegistry.register(g)
+	return g
+}
+
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.value, 1)
+}
+
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.value, -1)
+}
+
+func (g *Gauge) Set(value int64) {
+	atomic.StoreInt64(&g.value, value)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+func (g *Gauge) describe() (string, string, string) {
+	return g.name, g.help, "gauge"
+}
+
+func (g *Gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d\n", g.name, g.Value())
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// MAX_LABEL_VALUES caps how many label values a CounterVec tracks, as labels
+// can come from clients. Any further values are counted under OTHER_LABEL.
+const (
+	MAX_LABEL_VALUES = 200
+	OTHER_LABEL      = "other"
+)
+
+// CounterVec is a set of counters partitioned by the value of a label
+type CounterVec struct {
+	lock     sync.RWMutex
+	counters map[string]*Counter
+	name     string
+	help     string
+	label    string
+}
+
+// NewCounterVec creates a counter vector in the DefaultRegistry.
+func NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{
+		counters: make(map[string]*Counter),
+		name:     name,
+		help:     help,
+		label:    label,
+	}
+	DefaultRegistry.register(v)
+	return v
+}
+
+// WithLabel returns the counter for a label value.
+func (v *CounterVec) WithLabel(value string) *Counter {
+	v.lock.RLock()
+	c, ok := v.counters[value]
+	v.lock.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if c, ok := v.counters[value]; ok {
+		return c
+	}
+	if len(v.counters) >= MAX_LABEL_VALUES {
+		value = OTHER_LABEL
+		if c, ok := v.counters[value]; ok {
+			return c
+		}
+	}
+	c = &Counter{}
+	v.counters[value] = c
+	return c
+}
+
+func (v *CounterVec) describe() (string, string, string) {
+	return v.name, v.help, "counter"
+}
+
+func (v *CounterVec) write(w io.Writer) {
+	v.lock.RLock()
+	values := make([]string, 0, len(v.counters))
+	for value := range v.counters {
+		values = append(values, value)
+	}
+	v.lock.RUnlock()
+	sort.Strings(values)
+
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n",
+			v.name, v.label, escapeLabel(value), v.WithLabel(value).Value())
+	}
+}
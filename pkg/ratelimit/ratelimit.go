@@ -0,0 +1,101 @@
+// Package ratelimit implements token bucket rate limiting.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket which refills at a steady rate, up to a burst
+// size. It's safe to use from multiple goroutines.
+type Bucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a full bucket which refills at rate tokens per second,
+// holding at most burst tokens.
+func NewBucket(rate float64, burst int) *Bucket {
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket, returning false if it's empty.
+func (b *Bucket) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full returns true if the bucket would be full at the given time
+func (b *Bucket) full(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// SWEEP_INTERVAL is how often a KeyedBuckets forgets its full buckets
+const SWEEP_INTERVAL = time.Minute
+
+// KeyedBuckets keeps a separate Bucket for each key, e.g. each IP address.
+// Buckets are forgotten once they've refilled, as they're no different from a
+// new bucket. It's safe to use from multiple goroutines.
+type KeyedBuckets struct {
+	lock      sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+// NewKeyedBuckets creates buckets which refill at rate tokens per second,
+// holding at most burst tokens.
+func NewKeyedBuckets(rate float64, burst int) *KeyedBuckets {
+	return &KeyedBuckets{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*Bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the key's bucket, returning false if it's empty.
+func (k *KeyedBuckets) Allow(key string) bool {
+	k.lock.Lock()
+	now := time.Now()
+	if now.Sub(k.lastSweep) >= SWEEP_INTERVAL {
+		for key, b := range k.buckets {
+			if b.full(now) {
+				delete(k.buckets, key)
+			}
+		}
+		k.lastSweep = now
+	}
+
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	k.lock.Unlock()
+	return b.Allow()
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/lobby"
+	"go.uber.org/zap"
+)
+
+// LOBBY_LIST_INTERVAL is how often subscribers are sent the public lobbies,
+// if they've changed
+const LOBBY_LIST_INTERVAL = 2 * time.Second
+
+// lobbyBrowser keeps subscribed connections up to date with the public lobbies
+type lobbyBrowser struct {
+	lock        sync.Mutex
+	subscribers map[*comms.ConnectionWrapper]bool
+	lobbies     []lobby.LobbySummary
+}
+
+func newLobbyBrowser() *lobbyBrowser {
+	return &lobbyBrowser{subscribers: make(map[*comms.ConnectionWrapper]bool)}
+}
+
+// subscribe sends the connection the public lobbies, and any changes to them
+func (b *lobbyBrowser) subscribe(conn *comms.ConnectionWrapper, lobbies []lobby.LobbySummary) {
+	b.lock.Lock()
+	b.subscribers[conn] = true
+	b.lock.Unlock()
+
+	conn.Send(comms.ToMessage(lobby.LobbyListBroadcast{Lobbies: lobbies}))
+}
+
+func (b *lobbyBrowser) unsubscribe(conn *comms.ConnectionWrapper) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.subscribers, conn)
+}
+
+// update sends subscribers the public lobbies if they've changed. Subscribers
+// who aren't keeping up miss the update, catching up on the next one.
+func (b *lobbyBrowser) update(lobbies []lobby.LobbySummary) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if reflect.DeepEqual(lobbies, b.lobbies) {
+		return
+	}
+	b.lobbies = lobbies
+
+	message := comms.ToMessage(lobby.LobbyListBroadcast{Lobbies: lobbies})
+	for conn := range b.subscribers {
+		conn.TrySend(message)
+	}
+}
+
+// runLobbyBrowser updates lobby browser subscribers until ctx is done
+func (s *Server) runLobbyBrowser(ctx context.Context) {
+	ticker := time.NewTicker(LOBBY_LIST_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.browser.update(s.publicLobbies(""))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// publicLobbies lists the public lobbies ordered by name, only including those
+// for the given game if it's set
+func (s *Server) publicLobbies(game string) []lobby.LobbySummary {
+	lobbies := []lobby.LobbySummary{}
+	s.Lobbys.Range(func(lobbyID string, l *lobby.Lobby) bool {
+		summary := l.Summary()
+		if summary.Public && (game == "" || summary.Game == game) {
+			lobbies = append(lobbies, summary)
+		}
+		return true
+	})
+
+	sort.Slice(lobbies, func(i, j int) bool {
+		if lobbies[i].Name != lobbies[j].Name {
+			return lobbies[i].Name < lobbies[j].Name
+		}
+		return lobbies[i].LobbyID < lobbies[j].LobbyID
+	})
+	return lobbies
+}
+
+// listLobbies returns the public lobbies as JSON, optionally filtered by game
+func (s *Server) listLobbies() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := json.Marshal(s.publicLobbies(r.URL.Query().Get("game")))
+		if err != nil {
+			s.Log.Error("Unable to encode lobbies", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/lobby"
+	"go.uber.org/zap"
+)
+
+// Stats is a snapshot of the server's runtime state
+type Stats struct {
+	Lobbies          int `json:"lobbies"`
+	ConnectedPlayers int `json:"connectedPlayers"`
+
+	// RunningGames counts the lobbies running each game
+	RunningGames map[string]int `json:"runningGames"`
+
+	// Backlogs of messages waiting in lobby request channels and connection
+	// write channels
+	RequestBacklog Backlog `json:"requestBacklog"`
+	WriteBacklog   Backlog `json:"writeBacklog"`
+}
+
+type Backlog struct {
+	Total int `json:"total"`
+	Max   int `json:"max"`
+}
+
+func (b *Backlog) add(size int) {
+	b.Total += size
+	if size > b.Max {
+		b.Max = size
+	}
+}
+
+// Stats gathers the server's runtime stats
+func (s *Server) Stats() Stats {
+	stats := Stats{RunningGames: make(map[string]int)}
+
+	s.Lobbys.Range(func(lobbyID string, l *lobby.Lobby) bool {
+		stats.Lobbies++
+		if game := l.Summary().RunningGame; game != "" {
+			stats.RunningGames[game]++
+		}
+		stats.RequestBacklog.add(l.Backlog())
+		return true
+	})
+
+	s.ConnToPlayerStore.Range(func(conn *comms.ConnectionWrapper, player lobby.Player) bool {
+		stats.ConnectedPlayers++
+		stats.WriteBacklog.add(len(conn.WriteChannel))
+		return true
+	})
+	return stats
+}
+
+// healthz reports that the server is up
+func (s *Server) healthz() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
+
+// readyz reports whether the server is accepting new lobbies, which it stops
+// doing once it starts shutting down
+func (s *Server) readyz() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.isDraining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("shutting down"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
+
+// stats returns the server's runtime stats as JSON
+func (s *Server) stats() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := json.Marshal(s.Stats())
+		if err != nil {
+			s.Log.Error("Unable to encode stats", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import "github.com/JJ-Intelligence/SR-Games-Backend/pkg/metrics"
+
+var (
+	messagesReceived = metrics.NewCounterVec(
+		"srgames_messages_received_total",
+		"Number of messages received from clients, by message type.",
+		"type",
+	)
+	connectionsOpen = metrics.NewGauge(
+		"srgames_connections_open", "Number of open websocket connections.")
+
+	messagesRateLimited = metrics.NewCounterVec(
+		"srgames_messages_rate_limited_total",
+		"Number of messages dropped for being sent too quickly, by message type.",
+		"type",
+	)
+	rateLimitDisconnects = metrics.NewCounter(
+		"srgames_rate_limit_disconnects_total",
+		"Number of connections closed for repeatedly being rate limited.")
+	httpRateLimited = metrics.NewCounter(
+		"srgames_http_rate_limited_total",
+		"Number of requests to create players and lobbies which were rate limited.")
+)
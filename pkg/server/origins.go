@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CORS_MAX_AGE is how many seconds browsers can cache preflight responses for
+const CORS_MAX_AGE = "600"
+
+// AllowedOrigins is the list of browser origins allowed to use the server, e.g.
+// the frontend. Origins must match an entry's scheme and host exactly, except
+// that entries like https://*.example.com match any subdomain of example.com.
+type AllowedOrigins struct {
+	origins []allowedOrigin
+}
+
+type allowedOrigin struct {
+	scheme string
+	// host includes the port, if there is one
+	host string
+	// wildcard entries match subdomains of host
+	wildcard bool
+}
+
+// ParseAllowedOrigins parses a comma separated list of origins, e.g.
+// "https://example.com,https://*.example.com,http://localhost:3000"
+func ParseAllowedOrigins(list string) (*AllowedOrigins, error) {
+	allowed := &AllowedOrigins{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		u, err := url.Parse(entry)
+		if err != nil || u.Scheme == "" || u.Host == "" ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return nil, fmt.Errorf(
+				"invalid allowed origin %s, which should be like https://example.com", entry)
+		}
+
+		origin := allowedOrigin{
+			scheme: strings.ToLower(u.Scheme),
+			host:   strings.ToLower(u.Host),
+		}
+		if strings.HasPrefix(origin.host, "*.") {
+			origin.host = origin.host[1:]
+			origin.wildcard = true
+		} else if strings.Contains(origin.host, "*") {
+			return nil, fmt.Errorf(
+				"invalid allowed origin %s, which can only start with a wildcard", entry)
+		}
+		allowed.origins = append(allowed.origins, origin)
+	}
+
+	if len(allowed.origins) == 0 {
+		return nil, fmt.Errorf("no allowed origins given")
+	}
+	return allowed, nil
+}
+
+// Allowed returns true if the origin is in the list
+func (a *AllowedOrigins) Allowed(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+
+	for _, allowed := range a.origins {
+		if scheme != allowed.scheme {
+			continue
+		}
+		if host == allowed.host ||
+			(allowed.wildcard && strings.HasSuffix(host, allowed.host)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin checks a websocket upgrade request came from an allowed origin
+func (a *AllowedOrigins) CheckOrigin(r *http.Request) bool {
+	return a.Allowed(r.Header.Get("Origin"))
+}
+
+// CORS wraps a handler to let allowed origins call it from the browser,
+// answering preflight OPTIONS requests itself
+func (a *AllowedOrigins) CORS(
+	handler func(http.ResponseWriter, *http.Request),
+) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && a.Allowed(origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", CORS_MAX_AGE)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handler(w, r)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowedOrigins(t *testing.T) {
+	allowed, err := ParseAllowedOrigins(
+		"https://sr-games.herokuapp.com, https://*.example.com, http://localhost:3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://sr-games.herokuapp.com", true},
+		{"https://SR-Games.herokuapp.com", true},
+		{"https://sr-games.herokuapp.com.attacker.io", false},
+		{"https://evil-sr-games.herokuapp.com", false},
+		{"https://evil-sr-games.herokuapp.com.attacker.io", false},
+		{"https://games.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"https://evilexample.com", false},
+		{"https://games.example.com.attacker.io", false},
+		{"http://games.example.com", false},
+		{"http://sr-games.herokuapp.com", false},
+		{"http://localhost:3000", true},
+		{"http://localhost:3001", false},
+		{"http://localhost", false},
+		{"https://localhost:3000", false},
+		{"null", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := allowed.Allowed(test.origin); got != test.want {
+			t.Errorf("Allowed(%q) = %v, want %v", test.origin, got, test.want)
+		}
+	}
+}
+
+func TestParseAllowedOrigins(t *testing.T) {
+	tests := []struct {
+		list  string
+		valid bool
+	}{
+		{"https://example.com", true},
+		{"https://example.com/", true},
+		{"https://*.example.com,http://localhost:3000", true},
+		{"", false},
+		{" , ", false},
+		{"example.com", false},
+		{"*", false},
+		{"https://", false},
+		{"https://example.com/path", false},
+		{"https://example.com?query=1", false},
+		{"https://games.*.com", false},
+		{"https://*example.com", false},
+	}
+	for _, test := range tests {
+		if _, err := ParseAllowedOrigins(test.list); (err == nil) != test.valid {
+			t.Errorf("ParseAllowedOrigins(%q) returned error %v, want valid %v",
+				test.list, err, test.valid)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	allowed, err := ParseAllowedOrigins("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := allowed.CORS(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		method    string
+		origin    string
+		preflight bool
+		status    int
+		allowed   bool
+	}{
+		{"allowed request", http.MethodGet, "https://example.com", false, http.StatusOK, true},
+		{"disallowed request", http.MethodGet, "https://attacker.io", false, http.StatusOK, false},
+		{"no origin", http.MethodGet, "", false, http.StatusOK, false},
+		{"allowed preflight", http.MethodOptions, "https://example.com", true, http.StatusNoContent, true},
+		{"disallowed preflight", http.MethodOptions, "https://attacker.io", true, http.StatusForbidden, false},
+		{"null preflight", http.MethodOptions, "null", true, http.StatusForbidden, false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/createPlayer", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.preflight {
+			r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+		allowOrigin := w.Header().Get("Access-Control-Allow-Origin")
+		if test.allowed && allowOrigin != test.origin {
+			t.Errorf("%s: got Access-Control-Allow-Origin %q, want %q",
+				test.name, allowOrigin, test.origin)
+		} else if !test.allowed && allowOrigin != "" {
+			t.Errorf("%s: got Access-Control-Allow-Origin %q, want none", test.name, allowOrigin)
+		}
+	}
+}
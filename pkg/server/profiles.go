@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/lobby"
+	"github.com/mitchellh/mapstructure"
+)
+
+// PROFILE_EXPIRY_INTERVAL is how often unused profiles are forgotten
+const PROFILE_EXPIRY_INTERVAL = time.Hour
+
+// parseProfile reads a new player's profile from a request's name and color
+// query parameters
+func parseProfile(r *http.Request) (lobby.Profile, error) {
+	query := r.URL.Query()
+	profile := lobby.Profile{
+		Name:  strings.TrimSpace(query.Get("name")),
+		Color: query.Get("color"),
+	}
+	return profile, profile.Validate()
+}
+
+// updateProfile handles a PlayerUpdateProfileRequest from a player in a lobby,
+// storing their new profile for any lobby they join later
+func (s *Server) updateProfile(conn *comms.ConnectionWrapper, l *lobby.Lobby, message comms.Message) {
+	var req lobby.PlayerUpdateProfileRequest
+	if err := mapstructure.Decode(message.Contents, &req); err != nil {
+		conn.Send(comms.ToMessage(comms.ErrorResponse{
+			Reason: "Unable to parse PlayerUpdateProfileRequest",
+			Error:  err,
+		}))
+		return
+	}
+
+	profile, err := s.Profiles.Get(conn.PlayerID).Update(req)
+	if err != nil {
+		conn.Send(comms.ToMessage(comms.ErrorResponse{
+			Reason: "Invalid profile",
+			Error:  err,
+		}))
+		return
+	}
+	s.Profiles.Put(conn.PlayerID, profile)
+	l.UpdateProfile(conn, profile)
+}
+
+// runProfileExpiry forgets unused profiles until ctx is done
+func (s *Server) runProfileExpiry(ctx context.Context) {
+	ticker := time.NewTicker(PROFILE_EXPIRY_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Profiles.Expire()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/ratelimit"
+)
+
+var errRateLimited = errors.New("client sent too many rate limited messages")
+
+// messageLimiter limits how quickly a connection can send each type of
+// message. It's only used by the connection's reading goroutine.
+type messageLimiter struct {
+	limits  map[string]config.RateLimit
+	buckets map[string]*ratelimit.Bucket
+
+	// violations is taken from each time a message is rate limited, and the
+	// connection is disconnected once it's empty
+	violations *ratelimit.Bucket
+}
+
+func newMessageLimiter(limits config.RateLimitConfig) *messageLimiter {
+	maxViolations := limits.MaxViolationsPerMinute
+	return &messageLimiter{
+		limits:     limits.Messages,
+		buckets:    make(map[string]*ratelimit.Bucket),
+		violations: ratelimit.NewBucket(float64(maxViolations)/60, maxViolations),
+	}
+}
+
+// limitKey returns the key of the rate limit for a message type
+func (m *messageLimiter) limitKey(messageType string) string {
+	if _, ok := m.limits[messageType]; ok {
+		return messageType
+	}
+	if _, ok := m.limits[config.GAME_RATE_LIMIT]; ok && strings.HasPrefix(messageType, "Game/") {
+		return config.GAME_RATE_LIMIT
+	}
+	return config.DEFAULT_RATE_LIMIT
+}
+
+// allow returns true if a message of the given type can be handled, otherwise
+// returning whether the connection has been rate limited so often that it
+// should be disconnected
+func (m *messageLimiter) allow(messageType string) (allowed bool, disconnect bool) {
+	key := m.limitKey(messageType)
+	bucket, ok := m.buckets[key]
+	if !ok {
+		limit := m.limits[key]
+		bucket = ratelimit.NewBucket(limit.Rate, limit.Burst)
+		m.buckets[key] = bucket
+	}
+
+	if bucket.Allow() {
+		return true, false
+	}
+	return false, !m.violations.Allow()
+}
+
+// limitByIP wraps a handler to limit how quickly each IP address can call it
+func (s *Server) limitByIP(
+	handler func(http.ResponseWriter, *http.Request),
+) func(http.ResponseWriter, *http.Request) {
+	limit := s.Config.RateLimits.HTTP
+	buckets := ratelimit.NewKeyedBuckets(limit.Rate, limit.Burst)
+	// Retry-After is in whole seconds, rounded up to when a token is refilled
+	retryAfter := strconv.Itoa(int(math.Ceil(1 / limit.Rate)))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r, s.Config.RateLimits.TrustProxy)
+		if !buckets.Allow(ip) {
+			httpRateLimited.Inc()
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// clientIP returns the IP address of the client making a request, which is the
+// last X-Forwarded-For entry if the server is behind a trusted proxy
+func clientIP(r *http.Request, trustProxy bool) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); trustProxy && forwarded != "" {
+		entries := strings.Split(forwarded, ",")
+		return strings.TrimSpace(entries[len(entries)-1])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
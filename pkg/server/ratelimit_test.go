@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/lobby"
+	"github.com/gorilla/websocket"
+)
+
+// TestRateLimitedPlayerLosesSeat checks players disconnected for being rate
+// limited are removed from their lobby, rather than being able to resume their
+// session with their rate limits reset.
+func TestRateLimitedPlayerLosesSeat(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimits.Messages["LobbyTransferHostRequest"] = config.RateLimit{Rate: 0.001, Burst: 1}
+	s, ts := startTestServer(t, cfg)
+	defer ts.Close()
+
+	host, player := stressCreatePlayer(t, ts), stressCreatePlayer(t, ts)
+	lobbyID := stressCreateLobby(t, ts, host)
+	hostWS, _, err := stressJoin(ts, host, lobbyID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hostWS.Close()
+	go stressDrain(hostWS)
+
+	ws, resumeToken, err := stressJoin(ts, player, lobbyID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	for i := 0; i < 3; i++ {
+		ws.WriteJSON(comms.ToMessage(lobby.LobbyTransferHostRequest{PlayerID: player.PlayerID}))
+	}
+	for {
+		var message struct {
+			Type     string
+			Contents comms.RateLimitedResponse
+		}
+		if err := ws.ReadJSON(&message); err != nil {
+			t.Fatal("Connection closed before the player was told they were disconnected")
+		}
+		if message.Type == "RateLimitedResponse" && message.Contents.Disconnected {
+			break
+		}
+	}
+
+	l, _ := s.Lobbys.Get(lobbyID)
+	waitFor(t, "rate limited player to be removed", func() bool {
+		return l.Summary().Players == 1
+	})
+	ws, newResumeToken, err := stressJoin(ts, player, lobbyID, resumeToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if newResumeToken == resumeToken {
+		t.Error("Rate limited player resumed their session")
+	}
+}
+
+func TestConnectionsLimitedByIP(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimits.HTTP = config.RateLimit{Rate: 0.001, Burst: 2}
+	_, ts := startTestServer(t, cfg)
+	defer ts.Close()
+
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/"
+	header := http.Header{"Origin": {STRESS_ORIGIN}}
+	for i := 0; i < 2; i++ {
+		ws, _, err := websocket.DefaultDialer.Dial(u, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+	}
+	_, resp, err := websocket.DefaultDialer.Dial(u, header)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Connection over the limit wasn't refused with %d", http.StatusTooManyRequests)
+	}
+}
@@ -1,14 +1,21 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/auth"
 	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
 	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
 	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/lobby"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/metrics"
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/google/uuid"
@@ -18,7 +25,13 @@ import (
 
 const (
 	CHANNEL_BUFFER_LEN = 10
-	PING_TIMEOUT       = 50 * time.Second
+	// WRITE_BUFFER_LEN is how many messages can be queued for a client.
+	// Lobbies disconnect clients who fill it, so it has room for the messages
+	// a resumed player missed.
+	WRITE_BUFFER_LEN = 2 * lobby.MAX_MISSED_MESSAGES
+	// CLOSE_TIMEOUT is how long sockets are given to close once every lobby
+	// has closed during shutdown
+	CLOSE_TIMEOUT = 5 * time.Second
 )
 
 // Server stores all connection dependencies for the websocket server.
@@ -30,28 +43,69 @@ type Server struct {
 	// LobbyStore maps Lobby IDs to Lobby structs
 	Lobbys lobby.LobbyStore
 
-	ConnToPlayerStore map[*comms.ConnectionWrapper]lobby.Player
+	// ConnToPlayerStore maps connections to the players using them
+	ConnToPlayerStore lobby.PlayerStore
+
+	// Profiles stores how players are shown to each other
+	Profiles *lobby.ProfileStore
+
+	// Tokens signs and verifies players' session tokens
+	Tokens *auth.Signer
+
+	// Origins are the browser origins allowed to use the server
+	Origins *AllowedOrigins
 
 	Upgrader websocket.Upgrader
+
+	// draining is set to 1 once the server is shutting down
+	draining int32
+
+	// connections tracks the running connection handlers
+	connections sync.WaitGroup
+
+	// openConns are the open connections, including those which aren't in a
+	// lobby, so they can all be closed on shutdown
+	openConnsLock sync.Mutex
+	openConns     map[*comms.ConnectionWrapper]bool
+
+	browser *lobbyBrowser
 }
 
 // NewServer constructs a new Server instance.
-func NewServer(log *zap.Logger, checkOriginFunc func(r *http.Request) bool, config *config.Config) *Server {
+func NewServer(
+	log *zap.Logger,
+	origins *AllowedOrigins,
+	config *config.Config,
+	tokens *auth.Signer,
+) *Server {
 	return &Server{
 		Log:               log,
 		Config:            config,
 		Lobbys:            lobby.LobbyStore{},
-		ConnToPlayerStore: make(map[*comms.ConnectionWrapper]lobby.Player),
-		Upgrader:          websocket.Upgrader{CheckOrigin: checkOriginFunc},
+		ConnToPlayerStore: lobby.PlayerStore{},
+		Profiles:          &lobby.ProfileStore{},
+		Tokens:            tokens,
+		Origins:           origins,
+		Upgrader:          websocket.Upgrader{CheckOrigin: origins.CheckOrigin},
+		openConns:         make(map[*comms.ConnectionWrapper]bool),
+		browser:           newLobbyBrowser(),
 	}
 }
 
-// Start starts up the websocket server.
-func (s *Server) Start(port string, maxWorkers int, frontendHost string) {
-	// Handle incoming requests
-	http.HandleFunc("/createPlayer", handlerWrapper(frontendHost, s.createPlayer()))
-	http.HandleFunc("/createLobby", handlerWrapper(frontendHost, s.createLobby()))
-	http.HandleFunc("/", s.connectionReadHandler())
+// Start starts up the websocket server, shutting it down gracefully once ctx
+// is done.
+func (s *Server) Start(ctx context.Context, port string, maxWorkers int) {
+	httpServer := &http.Server{
+		Addr:    ":" + port,
+		Handler: s.Handler(),
+	}
+	go s.runLobbyBrowser(ctx)
+	go s.runProfileExpiry(ctx)
+	go func() {
+		<-ctx.Done()
+		s.Shutdown()
+		httpServer.Close()
+	}()
 
 	s.Log.Info(
 		fmt.Sprintf(
@@ -59,65 +113,232 @@ func (s *Server) Start(port string, maxWorkers int, frontendHost string) {
 			port, maxWorkers,
 		),
 	)
-	err := http.ListenAndServe(":"+port, nil)
-	if err != nil {
+	err := httpServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
 		s.Log.Fatal("Server errored during ListenAndServer:", zap.Error(err))
 	}
+	s.Log.Info("Server shut down")
 }
 
-// handlerWrapper wraps a handler to add the Access-Control-Allow-Origin header
-func handlerWrapper(
-	frontendHost string,
-	handler func(http.ResponseWriter, *http.Request),
-) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		//Allow CORS from frontendHost
-		w.Header().Set("Access-Control-Allow-Origin", frontendHost)
-		handler(w, r)
+// Handler returns the handler serving all of the server's endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/createPlayer", s.Origins.CORS(s.limitByIP(s.createPlayer())))
+	mux.HandleFunc("/createLobby", s.Origins.CORS(s.limitByIP(s.createLobby())))
+	mux.HandleFunc("/lobbies", s.Origins.CORS(s.listLobbies()))
+	mux.HandleFunc("/healthz", s.healthz())
+	mux.HandleFunc("/readyz", s.readyz())
+	mux.HandleFunc("/stats", s.stats())
+	mux.HandleFunc("/metrics", metrics.DefaultRegistry.Handler())
+	mux.HandleFunc("/", s.limitByIP(s.connectionReadHandler()))
+	return mux
+}
+
+// Shutdown stops new lobbies being created and tells every lobby the server is
+// shutting down. Lobbies close as their games end, and any still running after
+// the configured shutdown timeout are closed.
+func (s *Server) Shutdown() {
+	atomic.StoreInt32(&s.draining, 1)
+	deadline := time.Now().Add(s.Config.ShutdownTimeout)
+	s.Log.Info("Shutting down server", zap.Time("deadline", deadline))
+
+	var lobbies []*lobby.Lobby
+	s.Lobbys.Range(func(lobbyID string, l *lobby.Lobby) bool {
+		lobbies = append(lobbies, l)
+		return true
+	})
+	for _, l := range lobbies {
+		l.Drain(deadline)
+	}
+
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+	for _, l := range lobbies {
+		select {
+		case <-l.Done():
+			continue
+		case <-timeout.C:
+		}
+
+		s.Log.Info("Shutdown timeout reached, closing remaining lobbies")
+		for _, l := range lobbies {
+			l.Close()
+		}
+		break
+	}
+
+	// Connections which aren't in a lobby, like those browsing lobbies, aren't
+	// closed along with one
+	s.closeConnections(func(conn *comms.ConnectionWrapper) bool {
+		_, inLobby := s.ConnToPlayerStore.Get(conn)
+		return !inLobby
+	})
+
+	// Give sockets time to be sent LobbyClosedBroadcast and close
+	closed := make(chan struct{})
+	go func() {
+		s.connections.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(CLOSE_TIMEOUT):
+		s.closeConnections(func(*comms.ConnectionWrapper) bool { return true })
 	}
 }
 
-// createPlayer returns a new player ID
+// closeConnections closes the open connections matching filter
+func (s *Server) closeConnections(filter func(*comms.ConnectionWrapper) bool) {
+	s.openConnsLock.Lock()
+	defer s.openConnsLock.Unlock()
+	for conn := range s.openConns {
+		if filter(conn) {
+			conn.Close()
+		}
+	}
+}
+
+// isDraining returns true once the server is shutting down
+func (s *Server) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// CreatePlayerResponse is returned by /createPlayer. The token must be given
+// along with the player ID to create or join lobbies.
+type CreatePlayerResponse struct {
+	PlayerID string    `json:"playerID"`
+	Token    string    `json:"token"`
+	Expires  time.Time `json:"expires"`
+}
+
+// createPlayer returns a new player ID and session token. The player's display
+// name and color can be chosen with the name and color parameters.
 func (s *Server) createPlayer() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		profile, err := parseProfile(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
 		id := uuid.NewString()
+		if profile != (lobby.Profile{}) {
+			s.Profiles.Put(id, profile)
+		}
+		token, expires := s.Tokens.Sign(id)
 		s.Log.Info("Created new Player", zap.String("playerID", id))
+		body, _ := json.Marshal(CreatePlayerResponse{
+			PlayerID: id,
+			Token:    token,
+			Expires:  expires,
+		})
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(id))
+		w.Write(body)
 	}
 }
 
-// createLobby creates a new lobby, returning the lobby ID
+// checkSessionToken returns an error unless the token is a valid session token
+// for the player
+func (s *Server) checkSessionToken(playerID, token string) error {
+	tokenPlayerID, err := s.Tokens.Verify(token)
+	if err != nil {
+		return err
+	}
+	if tokenPlayerID != playerID {
+		return auth.ErrInvalidToken
+	}
+	return nil
+}
+
+// CreateLobbyResponse is returned by /createLobby
+type CreateLobbyResponse struct {
+	LobbyID  string `json:"lobbyID"`
+	JoinCode string `json:"joinCode"`
+}
+
+// createLobby creates a new lobby hosted by the player with the playerID and
+// token parameters, returning its ID and join code. The lobby's settings can be
+// chosen with the name, public, game, maxPlayers and password parameters.
 func (s *Server) createLobby() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if s.isDraining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
 		lobbyID := uuid.NewString()
 		playerIDParam := r.URL.Query()["playerID"]
+		settings, err := s.parseLobbySettings(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
 
 		if len(playerIDParam) == 1 && lobby.IsValidPlayerID(playerIDParam[0]) {
 			playerID := playerIDParam[0]
-			l := &lobby.Lobby{
-				Log:                 s.Log,
-				LobbyID:             lobbyID,
-				Host:                playerID,
-				PlayerIDToConnStore: make(map[string]*comms.ConnectionWrapper),
-				RequestChannel:      make(chan comms.Request, CHANNEL_BUFFER_LEN),
+			if err := s.checkSessionToken(playerID, r.URL.Query().Get("token")); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(err.Error()))
+				return
+			}
+
+			l := lobby.NewLobby(s.Log, lobbyID, playerID, settings, CHANNEL_BUFFER_LEN)
+			if err := s.Lobbys.Put(lobbyID, l); err != nil {
+				s.Log.Error("Unable to store lobby", zap.Error(err))
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
 			}
-			s.Lobbys.Put(lobbyID, l)
-			go l.LobbyRequestHandler(s.Config)
+			go func() {
+				l.LobbyRequestHandler(s.Config)
+				s.Lobbys.Delete(lobbyID)
+			}()
 
 			s.Log.Info(
 				"Created new Lobby",
 				zap.String("lobbyID", lobbyID),
+				zap.String("joinCode", l.JoinCode),
 				zap.String("hostID", playerID),
 			)
+			body, _ := json.Marshal(CreateLobbyResponse{
+				LobbyID:  lobbyID,
+				JoinCode: l.JoinCode,
+			})
+			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(lobbyID))
+			w.Write(body)
 		} else {
 			w.WriteHeader(http.StatusBadRequest)
 		}
 	}
 }
 
+// parseLobbySettings reads the settings for a new lobby from a request's
+// query parameters
+func (s *Server) parseLobbySettings(r *http.Request) (lobby.LobbySettings, error) {
+	query := r.URL.Query()
+	settings := lobby.DefaultLobbySettings()
+	settings.Name = strings.TrimSpace(query.Get("name"))
+	settings.Game = query.Get("game")
+	settings.Password = query.Get("password")
+
+	if public := query.Get("public"); public != "" {
+		var err error
+		if settings.Public, err = strconv.ParseBool(public); err != nil {
+			return settings, fmt.Errorf("invalid public flag %s", public)
+		}
+	}
+	if maxPlayers := query.Get("maxPlayers"); maxPlayers != "" {
+		var err error
+		if settings.MaxPlayers, err = strconv.Atoi(maxPlayers); err != nil {
+			return settings, fmt.Errorf("invalid max players %s", maxPlayers)
+		}
+	}
+	return settings, settings.Validate(s.Config)
+}
+
 // connectionReadHandler upgrades new HTTP requests from clients to websockets,
 // reading in further messages from those clients.
 func (s *Server) connectionReadHandler() func(w http.ResponseWriter, r *http.Request) {
@@ -128,30 +349,30 @@ func (s *Server) connectionReadHandler() func(w http.ResponseWriter, r *http.Req
 			s.Log.Info("Unable to upgrade connection", zap.Error(err))
 			return
 		}
-		conn := &comms.ConnectionWrapper{
-			Socket:       ws,
-			WriteChannel: make(chan comms.Message, CHANNEL_BUFFER_LEN),
-		}
+		conn := comms.NewConnectionWrapper(ws, WRITE_BUFFER_LEN, comms.ConnectionLimits{
+			MaxMessageSize: s.Config.Connection.MaxMessageSize,
+			PongTimeout:    s.Config.Connection.PongTimeout,
+			WriteTimeout:   s.Config.Connection.WriteTimeout,
+		})
+		s.connections.Add(1)
+		connectionsOpen.Inc()
+		s.openConnsLock.Lock()
+		s.openConns[conn] = true
+		s.openConnsLock.Unlock()
+		defer func() {
+			s.openConnsLock.Lock()
+			delete(s.openConns, conn)
+			s.openConnsLock.Unlock()
+			connectionsOpen.Dec()
+			s.connections.Done()
+		}()
 
-		// Remove the player when their socket disconnects
+		// Forget the connection when the socket disconnects. The lobby is told
+		// separately, as the player may still resume their session.
 		defer func() {
 			conn.Close()
-
-			if player, ok := s.ConnToPlayerStore[conn]; ok {
-				delete(s.ConnToPlayerStore, conn)
-				if l, ok := s.Lobbys.Get(player.LobbyID); ok {
-					delete(l.PlayerIDToConnStore, player.PlayerID)
-					s.Log.Info(fmt.Sprintf(
-						"Player %s left lobby %s", player.PlayerID, player.LobbyID))
-
-					// Close the lobby if this is the host
-					if l.Host == player.PlayerID {
-						s.Log.Info(fmt.Sprintf("Closing lobby %s", player.LobbyID))
-						l.Close()
-						s.Lobbys.Delete(player.LobbyID)
-					}
-				}
-			}
+			s.ConnToPlayerStore.Delete(conn)
+			s.browser.unsubscribe(conn)
 		}()
 
 		// Start up writer process
@@ -159,54 +380,70 @@ func (s *Server) connectionReadHandler() func(w http.ResponseWriter, r *http.Req
 
 		// Wait for a successful LobbyJoinRequest
 		var (
-			l *lobby.Lobby
+			l       *lobby.Lobby
+			limiter = newMessageLimiter(s.Config.RateLimits)
 		)
-		err = s.parseMessageLoop(conn, func(message comms.Message) (bool, error) {
+		err = s.parseMessageLoop(conn, limiter, func(message comms.Message) (bool, error) {
+			// Clients can browse public lobbies before joining one
+			switch message.Type {
+			case "LobbyListSubscribeRequest":
+				s.browser.subscribe(conn, s.publicLobbies(""))
+				return true, nil
+			case "LobbyListUnsubscribeRequest":
+				s.browser.unsubscribe(conn)
+				return true, nil
+			}
+
 			// Wait for a LobbyJoinRequest
 			if message.Type != "LobbyJoinRequest" {
-				conn.WriteChannel <- comms.ToMessage(comms.ErrorResponse{
+				conn.Send(comms.ToMessage(comms.ErrorResponse{
 					Reason: fmt.Sprintf(
 						"First message should be a LobbyJoinRequest but was %s", message.Type),
-				})
+				}))
 			} else {
 				// Parse the Message contents to a LobbyJoinRequest
 				var req lobby.LobbyJoinRequest
 				err = mapstructure.Decode(message.Contents, &req)
 
 				if err == nil {
-					if lobby.IsValidPlayerID(req.PlayerID) {
+					if err := s.checkSessionToken(req.PlayerID, req.Token); err != nil {
+						conn.Send(comms.ToMessage(lobby.InvalidSessionTokenResponse{
+							Expired: err == auth.ErrExpiredToken,
+						}))
+					} else if lobby.IsValidPlayerID(req.PlayerID) {
 						// Check if the lobby exists
 						lob, ok := s.Lobbys.Get(req.LobbyID)
+						if !ok && req.LobbyID == "" && req.JoinCode != "" {
+							lob, ok = s.Lobbys.GetByJoinCode(req.JoinCode)
+						}
 						l = lob
 						if ok {
+							req.LobbyID = l.LobbyID
 							// Add the player to the lobby if it exists
 							conn.PlayerID = req.PlayerID
-							s.ConnToPlayerStore[conn] = lobby.Player(req)
-							l.PlayerIDToConnStore[req.PlayerID] = conn
-							l.RequestChannel <- comms.Request{
-								ConnChannel: conn.WriteChannel,
-								PlayerID:    req.PlayerID,
-								Message:     comms.ToMessage(lobby.PlayerJoinedEvent{}),
+							err := l.Join(conn, req, s.Profiles.Get(req.PlayerID))
+							if err == nil {
+								s.ConnToPlayerStore.Put(conn, lobby.Player{
+									PlayerID: req.PlayerID,
+									LobbyID:  req.LobbyID,
+								})
+								s.browser.unsubscribe(conn)
+								return false, nil
+							} else if err == lobby.ErrLobbyClosed {
+								conn.Send(comms.ToMessage(lobby.LobbyDoesNotExistResponse{}))
 							}
-							s.Log.Info(
-								fmt.Sprintf(
-									"Player %s joined Lobby %s",
-									req.PlayerID, req.LobbyID,
-								),
-							)
-							return false, nil
 						} else {
-							conn.WriteChannel <- comms.ToMessage(lobby.LobbyDoesNotExistResponse{})
+							conn.Send(comms.ToMessage(lobby.LobbyDoesNotExistResponse{}))
 						}
 					} else {
-						conn.WriteChannel <- comms.ToMessage(comms.ErrorResponse{
+						conn.Send(comms.ToMessage(comms.ErrorResponse{
 							Reason: fmt.Sprintf("Invalid player ID %s", req.PlayerID),
-						})
+						}))
 					}
 				} else {
-					conn.WriteChannel <- comms.ToMessage(comms.ErrorResponse{
+					conn.Send(comms.ToMessage(comms.ErrorResponse{
 						Reason: "Unable to parse message contents to LobbyJoinRequest",
-					})
+					}))
 				}
 			}
 			return true, nil
@@ -216,46 +453,44 @@ func (s *Server) connectionReadHandler() func(w http.ResponseWriter, r *http.Req
 			return
 		}
 
-		// Keep websocket conection alive by sending a ping every 50 seconds
-		// (Heroku closes connections after 55s)
-		pingAfterTimeout(conn)
-
 		// Read in messages and push them onto the Lobby RequestChannel
-		err = s.parseMessageLoop(conn, func(message comms.Message) (bool, error) {
+		err = s.parseMessageLoop(conn, limiter, func(message comms.Message) (bool, error) {
 			switch message.Type {
 			case "LobbyLeaveRequest":
-				l.RequestChannel <- comms.Request{
-					ConnChannel: conn.WriteChannel,
-					PlayerID:    conn.PlayerID,
-					Message:     comms.ToMessage(lobby.PlayerLeftEvent{}),
-				}
+				l.Leave(conn)
 				return false, nil
-			default:
-				l.RequestChannel <- comms.Request{
-					ConnChannel: conn.WriteChannel,
-					PlayerID:    conn.PlayerID,
-					Message:     message,
-				}
+			case "PlayerUpdateProfileRequest":
+				s.updateProfile(conn, l, message)
 				return true, nil
+			default:
+				ok := l.Send(comms.Request{
+					Conn:     conn,
+					PlayerID: conn.PlayerID,
+					Message:  message,
+				})
+				return ok, nil
 			}
 		})
-		if err != nil {
+		if err == errRateLimited {
+			// Repeat offenders lose their place in the lobby, so they can't
+			// resume their session with their rate limits reset
+			l.Leave(conn)
+			s.Log.Info("Client removed from lobby for being rate limited",
+				zap.String("playerID", conn.PlayerID))
+		} else if err != nil {
+			// The client disconnected without leaving, so may still resume
+			l.Disconnect(conn)
 			s.Log.Info("Client errored in main loop", zap.Error(err))
 		}
 	}
 }
 
-func pingAfterTimeout(conn *comms.ConnectionWrapper) {
-	time.AfterFunc(PING_TIMEOUT, func() {
-		err := conn.WriteMessage(comms.ToMessage(comms.Ping{}))
-		if err == nil {
-			pingAfterTimeout(conn)
-		}
-	})
-}
-
+// parseMessageLoop reads messages from the connection until parseMessageCB
+// returns false, replying with a RateLimitedResponse to messages sent too
+// quickly and returning errRateLimited if that happens too often.
 func (s *Server) parseMessageLoop(
 	conn *comms.ConnectionWrapper,
+	limiter *messageLimiter,
 	parseMessageCB func(message comms.Message) (bool, error),
 ) error {
 	for {
@@ -264,16 +499,34 @@ func (s *Server) parseMessageLoop(
 
 		if err != nil {
 			if _, ok := err.(*json.UnmarshalTypeError); ok {
-				conn.WriteChannel <- comms.ToMessage(comms.ErrorResponse{
+				conn.Send(comms.ToMessage(comms.ErrorResponse{
 					Reason: "Unable to deserialise message",
 					Error:  err,
-				})
+				}))
 			} else {
 				// Client has disconnected or errored
-				parseMessageCB(comms.ToMessage(lobby.LobbyLeaveRequest{}))
 				return err
 			}
 		} else {
+			messagesReceived.WithLabel(message.Type).Inc()
+			if allowed, disconnect := limiter.allow(message.Type); !allowed {
+				messagesRateLimited.WithLabel(message.Type).Inc()
+				conn.Send(comms.ToMessage(comms.RateLimitedResponse{
+					MessageType:  message.Type,
+					Disconnected: disconnect,
+				}))
+				if disconnect {
+					// Give the writer a chance to send the response, after which it
+					// closes the connection
+					rateLimitDisconnects.Inc()
+					select {
+					case <-conn.Closed():
+					case <-time.After(CLOSE_TIMEOUT):
+					}
+					return errRateLimited
+				}
+				continue
+			}
 			if ok, err := parseMessageCB(message); !ok {
 				return err
 			}
@@ -281,14 +534,51 @@ func (s *Server) parseMessageLoop(
 	}
 }
 
+// connectionWriteHandler is the only goroutine which writes messages to a
+// connection's socket. It pings the client every PingInterval, which keeps the
+// connection alive (Heroku closes idle connections after 55s), and lets the
+// reader notice the client has gone once it stops answering.
 func (s *Server) connectionWriteHandler(conn *comms.ConnectionWrapper) {
-	for {
-		message := <-conn.WriteChannel
-		conn.WriteMessage(message)
+	var ping <-chan time.Time
+	if interval := s.Config.Connection.PingInterval; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
 
-		if _, ok := message.Contents.(lobby.LobbyClosedBroadcast); ok {
-			conn.Socket.Close()
+	for {
+		select {
+		case message := <-conn.WriteChannel:
+			if err := conn.WriteMessage(message); err != nil {
+				conn.Close()
+				return
+			}
+			if reason, ok := closingMessage(message); ok {
+				conn.WriteClose(reason)
+				conn.Close()
+				return
+			}
+		case <-ping:
+			if err := conn.WritePing(); err != nil {
+				conn.Close()
+				return
+			}
+		case <-conn.Closed():
 			return
 		}
 	}
 }
+
+// closingMessage returns true if the connection should be closed once the
+// message has been sent, and the reason why
+func closingMessage(message comms.Message) (string, bool) {
+	switch contents := message.Contents.(type) {
+	case lobby.LobbyClosedBroadcast:
+		return "Lobby closed", true
+	case lobby.KickedFromLobbyBroadcast:
+		return "Kicked from lobby", true
+	case comms.RateLimitedResponse:
+		return "Rate limited", contents.Disconnected
+	}
+	return "", false
+}
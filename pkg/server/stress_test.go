@@ -0,0 +1,307 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/auth"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/config"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/lobby"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	STRESS_LOBBIES = 4
+	STRESS_PLAYERS = 8
+	STRESS_ROUNDS  = 10
+	STRESS_ORIGIN  = "http://frontend.test"
+)
+
+var errStressRefused = errors.New("join refused")
+
+// TestConcurrentJoinsAndLeaves has players repeatedly join, leave, drop and
+// resume their sessions in several lobbies at once, while others browse the
+// lobbies. Run it with -race to check the server is free of data races.
+func TestConcurrentJoinsAndLeaves(t *testing.T) {
+	s, ts := startTestServer(t, testConfig())
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.runLobbyBrowser(ctx)
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, STRESS_LOBBIES*(STRESS_PLAYERS+2))
+	)
+	lobbyIDs := make([]string, STRESS_LOBBIES)
+	hosts := make([]*websocket.Conn, STRESS_LOBBIES)
+	for i := range lobbyIDs {
+		host := stressCreatePlayer(t, ts)
+		lobbyIDs[i] = stressCreateLobby(t, ts, host)
+		ws, _, err := stressJoin(ts, host, lobbyIDs[i], "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts[i] = ws
+		go stressDrain(ws)
+
+		for j := 0; j < STRESS_PLAYERS; j++ {
+			wg.Add(1)
+			go func(lobbyID string) {
+				defer wg.Done()
+				if err := stressPlayer(ts, stressCreatePlayer(t, ts), lobbyID); err != nil {
+					errs <- err
+				}
+			}(lobbyIDs[i])
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := stressBrowse(ts); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Everyone but the hosts has left, or dropped and then been removed once
+	// their grace period expired
+	waitFor(t, "players to leave", func() bool {
+		for _, lobbyID := range lobbyIDs {
+			l, ok := s.Lobbys.Get(lobbyID)
+			if !ok || l.Summary().Players != 1 {
+				return false
+			}
+		}
+		return s.Stats().ConnectedPlayers == STRESS_LOBBIES
+	})
+
+	s.Shutdown()
+	for _, ws := range hosts {
+		ws.Close()
+	}
+	if stats := s.Stats(); stats.Lobbies != 0 {
+		t.Errorf("%d lobbies still open after shutdown", stats.Lobbies)
+	}
+}
+
+// testConfig returns a config with limits high enough that they don't get in
+// the way of tests
+func testConfig() *config.Config {
+	return &config.Config{
+		Games:                map[string]game.Game{},
+		ReconnectGracePeriod: 100 * time.Millisecond,
+		ShutdownTimeout:      time.Second,
+		RateLimits: config.RateLimitConfig{
+			Messages: map[string]config.RateLimit{
+				config.DEFAULT_RATE_LIMIT: {Rate: 1000, Burst: 1000},
+			},
+			MaxViolationsPerMinute: 1,
+			HTTP:                   config.RateLimit{Rate: 1000, Burst: 1000},
+		},
+		Connection: config.ConnectionConfig{
+			MaxMessageSize: config.DEFAULT_MAX_MESSAGE_SIZE,
+			PingInterval:   20 * time.Millisecond,
+			PongTimeout:    5 * time.Second,
+			WriteTimeout:   5 * time.Second,
+		},
+	}
+}
+
+func startTestServer(t *testing.T, cfg *config.Config) (*Server, *httptest.Server) {
+	origins, err := ParseAllowedOrigins(STRESS_ORIGIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(zap.NewNop(), origins, cfg, auth.NewSigner([]byte("secret"), time.Hour))
+	return s, httptest.NewServer(s.Handler())
+}
+
+// stressPlayer joins the lobby, sends a few messages and then either leaves or
+// drops the connection, resuming the session next time if it dropped
+func stressPlayer(ts *httptest.Server, player CreatePlayerResponse, lobbyID string) error {
+	resumeToken := ""
+	for i := 0; i < STRESS_ROUNDS; i++ {
+		ws, token, err := stressJoin(ts, player, lobbyID, resumeToken)
+		if err == errStressRefused {
+			// The lobby hasn't handled our last leave yet, so try again
+			time.Sleep(5 * time.Millisecond)
+			i--
+			continue
+		} else if err != nil {
+			return err
+		}
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			stressDrain(ws)
+		}()
+
+		for j := rand.Intn(4); j > 0; j-- {
+			ws.WriteJSON(comms.ToMessage(lobby.LobbyTransferHostRequest{
+				PlayerID: player.PlayerID,
+			}))
+		}
+
+		if rand.Intn(2) == 0 {
+			// Wait for the server to hang up, as closing first could reset the
+			// connection before it reads the leave request
+			ws.WriteJSON(comms.ToMessage(lobby.LobbyLeaveRequest{}))
+			<-drained
+			resumeToken = ""
+		} else {
+			resumeToken = token
+		}
+		ws.Close()
+	}
+	return nil
+}
+
+// stressBrowse repeatedly subscribes to the lobby browser, waiting for the
+// lobbies to be sent, and then unsubscribes
+func stressBrowse(ts *httptest.Server) error {
+	ws, err := stressDial(ts)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < STRESS_ROUNDS; i++ {
+		ws.WriteJSON(comms.ToMessage(lobby.LobbyListSubscribeRequest{}))
+		for {
+			var message comms.Message
+			if err := ws.ReadJSON(&message); err != nil {
+				return fmt.Errorf("browsing lobbies: %s", err.Error())
+			}
+			if message.Type == "LobbyListBroadcast" {
+				break
+			}
+		}
+		ws.WriteJSON(comms.ToMessage(lobby.LobbyListUnsubscribeRequest{}))
+	}
+	return nil
+}
+
+// stressJoin connects and joins the lobby, returning the player's resume token,
+// or errStressRefused if the lobby turned them away
+func stressJoin(
+	ts *httptest.Server,
+	player CreatePlayerResponse,
+	lobbyID, resumeToken string,
+) (*websocket.Conn, string, error) {
+	ws, err := stressDial(ts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = ws.WriteJSON(comms.ToMessage(lobby.LobbyJoinRequest{
+		PlayerID:    player.PlayerID,
+		Token:       player.Token,
+		LobbyID:     lobbyID,
+		ResumeToken: resumeToken,
+	}))
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for err == nil {
+		var message struct {
+			Type     string
+			Contents lobby.LobbyJoinResponse
+		}
+		if err = ws.ReadJSON(&message); err != nil {
+			break
+		}
+
+		switch message.Type {
+		case "LobbyJoinResponse":
+			ws.SetReadDeadline(time.Time{})
+			return ws, message.Contents.ResumeToken, nil
+		case "LobbyResumeFailedResponse":
+			err = errStressRefused
+		case "LobbyDoesNotExistResponse", "InvalidSessionTokenResponse", "ErrorResponse":
+			err = fmt.Errorf("unable to join lobby %s: %s", lobbyID, message.Type)
+		}
+	}
+	ws.Close()
+	return nil, "", err
+}
+
+func stressDial(ts *httptest.Server) (*websocket.Conn, error) {
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/"
+	ws, _, err := websocket.DefaultDialer.Dial(u, http.Header{"Origin": {STRESS_ORIGIN}})
+	return ws, err
+}
+
+// stressDrain reads messages until the connection closes, so the server never
+// blocks writing to it
+func stressDrain(ws *websocket.Conn) {
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func stressCreatePlayer(t *testing.T, ts *httptest.Server) CreatePlayerResponse {
+	var player CreatePlayerResponse
+	if err := json.Unmarshal(stressGet(t, ts, "/createPlayer", nil), &player); err != nil {
+		t.Error(err)
+	}
+	return player
+}
+
+func stressCreateLobby(t *testing.T, ts *httptest.Server, host CreatePlayerResponse) string {
+	var created CreateLobbyResponse
+	body := stressGet(t, ts, "/createLobby", url.Values{
+		"playerID": {host.PlayerID},
+		"token":    {host.Token},
+	})
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatal(err)
+	}
+	return created.LobbyID
+}
+
+func stressGet(t *testing.T, ts *httptest.Server, path string, query url.Values) []byte {
+	resp, err := http.Get(ts.URL + path + "?" + query.Encode())
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("%s returned %s: %s", path, resp.Status, body)
+	}
+	return body
+}
+
+// waitFor polls until done returns true, failing the test if it takes too long
+func waitFor(t *testing.T, what string, done func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
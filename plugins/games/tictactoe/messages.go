@@ -1,4 +1,4 @@
-package main
+package tictactoe
 
 type PlayerSymbolsBroadcast struct {
 	PlayerNought string `json:"playerNought"`
@@ -27,3 +27,5 @@ type MakeMoveBroadcast struct {
 type WinnerBroadcast struct {
 	PlayerID string `json:"playerID"`
 }
+
+type DrawBroadcast struct{}
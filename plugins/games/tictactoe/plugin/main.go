@@ -0,0 +1,15 @@
+// Builds TicTacToe as a Go plugin, for servers which load it from a .so file
+// rather than linking it in:
+//
+//	go build -buildmode=plugin -o tictactoe.so ./plugins/games/tictactoe/plugin
+package main
+
+import (
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+	"github.com/JJ-Intelligence/SR-Games-Backend/plugins/games/tictactoe"
+)
+
+var Game game.Game = tictactoe.TicTacToe{}
+
+// main is never run, but allows the package to build outside plugin mode
+func main() {}
@@ -0,0 +1,173 @@
+package tictactoe
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+	"github.com/mitchellh/mapstructure"
+)
+
+const NUM_PLAYERS = 2
+
+func init() {
+	game.Register("tictactoe", TicTacToe{})
+}
+
+// TicTacToe implements game.Game
+type TicTacToe struct{}
+
+type State struct {
+	Players []string // {Nought, Cross}
+	Board   [3][3]int
+
+	currentPlayer int
+	finished      bool
+}
+
+func (s State) isValidMove(x, y int) bool {
+	return x >= 0 && y >= 0 && x < len(s.Board) && y < len(s.Board) && s.Board[x][y] == 0
+}
+
+// isWinner checks whether the move at (x, y) completed a line
+func (s State) isWinner(x, y int) bool {
+	player := s.Board[x][y]
+	size := len(s.Board)
+	row, column, diagonal, antiDiagonal := true, true, true, true
+	for i := 0; i < size; i++ {
+		row = row && s.Board[x][i] == player
+		column = column && s.Board[i][y] == player
+		diagonal = diagonal && s.Board[i][i] == player
+		antiDiagonal = antiDiagonal && s.Board[i][size-1-i] == player
+	}
+	return row || column ||
+		(x == y && diagonal) ||
+		(x+y == size-1 && antiDiagonal)
+}
+
+func (s State) isBoardFull() bool {
+	for _, row := range s.Board {
+		for _, cell := range row {
+			if cell == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// winner ends the game with the given player as the winner
+func (s *State) winner(ctx *game.Context, player string) {
+	ctx.BroadcastPublic(WinnerBroadcast{player})
+	result := game.Result{Winners: []string{player}}
+	for _, p := range s.Players {
+		if p != player {
+			result.Losers = append(result.Losers, p)
+		}
+	}
+	ctx.End(result)
+	s.finished = true
+}
+
+func (TicTacToe) MinPlayers() int {
+	return NUM_PLAYERS
+}
+
+func (TicTacToe) MaxPlayers() int {
+	return NUM_PLAYERS
+}
+
+func (TicTacToe) NewState(ctx *game.Context) (game.State, error) {
+	players := ctx.Players()
+	if len(players) != NUM_PLAYERS {
+		return nil, fmt.Errorf("invalid number of players, should be %d", NUM_PLAYERS)
+	}
+
+	return &State{
+		Players:       players,
+		Board:         [3][3]int{},
+		currentPlayer: rand.Intn(len(players)),
+		finished:      false,
+	}, nil
+}
+
+func (state *State) HandleRequest(
+	ctx *game.Context,
+	player,
+	messageType string,
+	messageContents interface{},
+) interface{} {
+	if state.finished {
+		return comms.ErrorResponse{Reason: "Game has already ended"}
+	}
+
+	// Handle the request
+	switch messageType {
+	case "PlayerGetGameSetupRequest":
+		// Return game setup information to clients
+		ctx.BroadcastPublic(PlayerSymbolsBroadcast{
+			PlayerNought: state.Players[0],
+			PlayerCross:  state.Players[1],
+		})
+		ctx.BroadcastPublic(PlayerTurnBroadcast{
+			PlayerID: state.Players[state.currentPlayer],
+		})
+
+	case "MakeMoveRequest":
+		// A player makes a move
+		currentPlayer := state.Players[state.currentPlayer]
+		if player == currentPlayer {
+			var contents MakeMoveRequest
+			err := mapstructure.Decode(messageContents, &contents)
+
+			if err == nil {
+				if state.isValidMove(contents.X, contents.Y) {
+					// Update state and inform players of move
+					state.Board[contents.X][contents.Y] = state.currentPlayer + 1
+					state.currentPlayer = (state.currentPlayer + 1) % len(state.Players)
+					ctx.Send(MakeMoveResponse{true}, player)
+					ctx.BroadcastPublic(MakeMoveBroadcast{
+						X:        contents.X,
+						Y:        contents.Y,
+						PlayerID: player,
+					})
+
+					if state.isWinner(contents.X, contents.Y) {
+						// The current player has won the game
+						state.winner(ctx, player)
+					} else if state.isBoardFull() {
+						ctx.BroadcastPublic(DrawBroadcast{})
+						ctx.End(game.Result{Draw: true})
+						state.finished = true
+					} else {
+						// Tell the next player to make a move
+						ctx.BroadcastPublic(
+							PlayerTurnBroadcast{state.Players[state.currentPlayer]})
+					}
+				} else {
+					return MakeMoveResponse{false}
+				}
+			} else {
+				return comms.ErrorDecodingMessageResponse{}
+			}
+		} else {
+			return comms.ErrorResponse{Reason: "Not your turn"}
+		}
+	}
+
+	return nil
+}
+
+// OnPlayerLeft forfeits the game for a player who leaves mid-game
+func (state *State) OnPlayerLeft(ctx *game.Context, player string) {
+	if state.finished {
+		return
+	}
+
+	for _, opponent := range state.Players {
+		if opponent != player {
+			state.winner(ctx, opponent)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package tictactoe
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/comms"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game"
+	"github.com/JJ-Intelligence/SR-Games-Backend/pkg/game/gametest"
+)
+
+const (
+	nought = "nought"
+	cross  = "cross"
+)
+
+// move is a MakeMoveRequest, as decoded from a client's JSON
+type move map[string]interface{}
+
+func TestRegistered(t *testing.T) {
+	if g, ok := game.Lookup("tictactoe"); !ok || g != (TicTacToe{}) {
+		t.Errorf("Lookup returned %v, %v", g, ok)
+	}
+}
+
+func TestNewStateNeedsTwoPlayers(t *testing.T) {
+	for _, players := range [][]string{{nought}, {nought, cross, "third"}} {
+		if _, err := (TicTacToe{}).NewState(gametest.NewLobby(players...).Context()); err == nil {
+			t.Errorf("Started a game with %d players", len(players))
+		}
+	}
+}
+
+func TestWin(t *testing.T) {
+	lobby, state := newTestGame(t)
+	moves := []struct {
+		player string
+		x, y   int
+	}{
+		{nought, 0, 0}, {cross, 1, 0}, {nought, 0, 1}, {cross, 1, 1}, {nought, 0, 2},
+	}
+	for _, m := range moves {
+		if response := makeMove(lobby, state, m.player, m.x, m.y); response != nil {
+			t.Fatalf("Move by %s to (%d, %d) returned %v", m.player, m.x, m.y, response)
+		}
+	}
+
+	want := game.Result{Winners: []string{nought}, Losers: []string{cross}}
+	if lobby.Result == nil || !reflect.DeepEqual(*lobby.Result, want) {
+		t.Errorf("Game ended with %v, want %v", lobby.Result, want)
+	}
+	if last := lobby.Sent[len(lobby.Sent)-1]; last.Contents != (WinnerBroadcast{nought}) || !last.Public {
+		t.Errorf("Last message was %v, want a public WinnerBroadcast", last)
+	}
+
+	response := makeMove(lobby, state, cross, 2, 2)
+	if _, ok := response.(comms.ErrorResponse); !ok {
+		t.Errorf("Move after the game ended returned %v, want an ErrorResponse", response)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	lobby, state := newTestGame(t)
+	// Fills the board without either player completing a line:
+	//	O X O
+	//	O X X
+	//	X O O
+	moves := []struct {
+		player string
+		x, y   int
+	}{
+		{nought, 0, 0}, {cross, 0, 1}, {nought, 0, 2}, {cross, 1, 1}, {nought, 1, 0},
+		{cross, 1, 2}, {nought, 2, 1}, {cross, 2, 0}, {nought, 2, 2},
+	}
+	for _, m := range moves {
+		if response := makeMove(lobby, state, m.player, m.x, m.y); response != nil {
+			t.Fatalf("Move by %s to (%d, %d) returned %v", m.player, m.x, m.y, response)
+		}
+	}
+
+	if lobby.Result == nil || !lobby.Result.Draw {
+		t.Errorf("Game ended with %v, want a draw", lobby.Result)
+	}
+}
+
+func TestInvalidMoves(t *testing.T) {
+	lobby, state := newTestGame(t)
+	makeMove(lobby, state, nought, 1, 1)
+
+	tests := []struct {
+		name     string
+		player   string
+		contents interface{}
+		want     interface{}
+	}{
+		{"out of turn", nought, move{"x": 0, "y": 0}, comms.ErrorResponse{Reason: "Not your turn"}},
+		{"taken square", cross, move{"x": 1, "y": 1}, MakeMoveResponse{false}},
+		{"off the board", cross, move{"x": 3, "y": 0}, MakeMoveResponse{false}},
+		{"negative square", cross, move{"x": 0, "y": -1}, MakeMoveResponse{false}},
+		{"undecodable", cross, move{"x": "middle", "y": 0}, comms.ErrorDecodingMessageResponse{}},
+	}
+	for _, test := range tests {
+		response := state.HandleRequest(lobby.Context(), test.player, "MakeMoveRequest", test.contents)
+		if response != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, response, test.want)
+		}
+	}
+
+	if lobby.Result != nil {
+		t.Errorf("Invalid moves ended the game with %v", lobby.Result)
+	}
+	if state.Board != [3][3]int{{0, 0, 0}, {0, 1, 0}, {0, 0, 0}} {
+		t.Errorf("Invalid moves changed the board to %v", state.Board)
+	}
+}
+
+func TestPlayerLeftForfeits(t *testing.T) {
+	lobby, state := newTestGame(t)
+	state.OnPlayerLeft(lobby.Context(), nought)
+
+	want := game.Result{Winners: []string{cross}, Losers: []string{nought}}
+	if lobby.Result == nil || !reflect.DeepEqual(*lobby.Result, want) {
+		t.Errorf("Game ended with %v, want %v", lobby.Result, want)
+	}
+}
+
+// newTestGame starts a game where nought moves first
+func newTestGame(t *testing.T) (*gametest.Lobby, *State) {
+	lobby := gametest.NewLobby(nought, cross)
+	s, err := (TicTacToe{}).NewState(lobby.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := s.(*State)
+	state.currentPlayer = 0
+	return lobby, state
+}
+
+func makeMove(lobby *gametest.Lobby, state *State, player string, x, y int) interface{} {
+	return state.HandleRequest(lobby.Context(), player, "MakeMoveRequest", move{"x": x, "y": y})
+}